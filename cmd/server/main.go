@@ -3,9 +3,11 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -14,19 +16,36 @@ import (
 
 	"github.com/spf13/viper"
 
+	"dns-failover/internal/agent"
 	"dns-failover/internal/api"
 	"dns-failover/internal/config"
+	"dns-failover/internal/dnsserver"
+	"dns-failover/internal/drift"
 	"dns-failover/internal/monitor"
+	"dns-failover/internal/outbox"
+	"dns-failover/internal/propagation"
 	"dns-failover/internal/service"
 
 	"github.com/gin-gonic/gin"
 )
 
+// shutdownTimeout bounds how long shutdown waits for API requests and pending DNS updates.
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	// 解析命令行参数
 	resetToken := flag.Bool("reset-token", false, "重置认证令牌")
+	agentMode := flag.Bool("agent", false, "以探测代理模式运行，将探测结果上报给主服务")
+	serverURL := flag.String("server", "", "代理模式：主服务地址，例如 http://10.0.0.1:8081")
+	agentToken := flag.String("agent-token", "", "代理模式：代理认证令牌")
 	flag.Parse()
 
+	// 如果是探测代理模式，只运行探测并上报，不启动 API 服务
+	if *agentMode {
+		runAgent(*serverURL, *agentToken)
+		return
+	}
+
 	// 初始化持久化存储
 	store := config.NewStore("data.json")
 	if err := store.Load(); err != nil {
@@ -73,7 +92,7 @@ func main() {
 	if len(store.ListMonitors()) == 0 && len(cfg.Monitors) > 0 {
 		log.Println("Importing initial monitors from config.yaml")
 		for _, m := range cfg.Monitors {
-			if err := store.UpsertMonitor(m); err != nil {
+			if err := store.UpsertMonitor(&m); err != nil {
 				log.Printf("Failed to import monitor %s: %v", m.Name, err)
 			}
 		}
@@ -85,8 +104,22 @@ func main() {
 	// 使用 store 中的配置
 	// currentCfg := store.GetSnapshot() // 不再需要，使用 cfg 替代
 
+	// 未绑定账户的 Cloudflare 监控固定到当前激活的账户，之后切换激活账户不再影响它们
+	if bound, err := store.BindUnboundMonitors(); err != nil {
+		log.Printf("Failed to bind monitors to the active Cloudflare account: %v", err)
+	} else if len(bound) > 0 {
+		log.Printf("Bound %d monitors to the active Cloudflare account", len(bound))
+	}
+
+	// DNS 更新队列：切换写入 data.json 后再执行，失败按退避重试，重启后继续
+	dnsOutbox := outbox.New(store)
+
 	engine := monitor.NewEngine()
-	engine.OnSwitch = func(m *monitor.Monitor, toBackup bool) {
+	engine.SetQuorum(store.GetQuorumConfig())
+	engine.SetCanaries(store.GetCanaryConfig())
+	engine.SetCircuitBreaker(store.GetCircuitBreakerConfig())
+	engine.SetScheduler(store.GetSchedulerConfig())
+	engine.OnSwitch = func(ctx context.Context, m *monitor.Monitor, toBackup bool, reason string) {
 		targetIP := m.Config.OriginalIP
 		proxied := m.Config.OriginalIPCDNEnabled
 		msg := fmt.Sprintf("服务器 %s 已恢复，切回原始 IP: %s", m.Config.Name, targetIP)
@@ -96,45 +129,48 @@ func main() {
 			proxied = m.Config.BackupIPCDNEnabled
 			msg = fmt.Sprintf("服务器 %s 宕机，切换到备用 IP: %s", m.Config.Name, targetIP)
 		}
+		if reason == "external" {
+			msg = "外部告警触发：" + msg
+		}
+
+		dependents := engine.Dependents(m.Config.ID)
+		if len(dependents) > 0 {
+			msg += fmt.Sprintf("（下游监控：%s）", strings.Join(dependents, "、"))
+		}
 
 		log.Println(msg)
 		service.NewNotificationService(store.GetDingTalkConfig(), store.GetEmailConfig(), store.GetTelegramConfig()).Notify(msg)
 
 		fromIP := m.Config.BackupIP
 		toIP := m.Config.OriginalIP
-		reason := "restore"
 		if toBackup {
 			fromIP = m.Config.OriginalIP
 			toIP = m.Config.BackupIP
-			reason = "failover"
 		}
 		_ = store.AppendSwitchEvent(config.SwitchEvent{
-			Timestamp: time.Now().UnixMilli(),
-			MonitorID: m.Config.ID,
-			Name:      m.Config.Name,
-			FromIP:    fromIP,
-			ToIP:      toIP,
-			ToBackup:  toBackup,
-			CheckType: m.Config.CheckType,
-			Reason:    reason,
+			Timestamp:  time.Now().UnixMilli(),
+			MonitorID:  m.Config.ID,
+			Name:       m.Config.Name,
+			FromIP:     fromIP,
+			ToIP:       toIP,
+			ToBackup:   toBackup,
+			CheckType:  m.Config.CheckType,
+			Reason:     reason,
+			Dependents: dependents,
 		}, 200)
 
-		ctx := context.Background()
-		for _, sub := range m.Config.Subdomains {
-			// 每次切换时重新获取最新的 DNS 服务实例，以防配置变更
-			latestCF := store.GetCloudflareConfig()
-			d, err := service.NewDNSService(latestCF)
-			if err != nil {
-				log.Printf("Failed to init DNS service for switch: %v", err)
-				continue
-			}
-			if err := d.UpdateRecordBySubdomain(ctx, m.Config.ZoneID, sub, targetIP, proxied); err != nil {
-				log.Printf("Failed to update DNS for %s: %v", sub, err)
-			}
+		// ctx 在监控被停止或替换时取消，过期的监控不得再修改 DNS；更新进入持久化队列，失败后自动重试
+		if ctx.Err() != nil {
+			log.Printf("Monitor %s stopped, dropping DNS switch", m.Config.Name)
+			return
+		}
+		if err := dnsOutbox.Enqueue(m.Config, targetIP, proxied, reason); err != nil {
+			log.Printf("Failed to queue DNS switch for %s: %v", m.Config.Name, err)
 		}
 	}
-	engine.OnScheduledSwitch = func(m *monitor.Monitor, fromIP, toIP string) {
-		if m.Config.ZoneID == "" {
+	engine.OnScheduledSwitch = func(ctx context.Context, m *monitor.Monitor, fromIP, toIP string) {
+		if m.Config.ZoneID == "" && service.NeedsZone(m.Config) {
+			log.Printf("Monitor %s has no zone, skipping scheduled DNS switch", m.Config.Name)
 			return
 		}
 
@@ -161,20 +197,20 @@ func main() {
 			Reason:    "schedule",
 		}, 200)
 
-		ctx := context.Background()
-		for _, sub := range m.Config.Subdomains {
-			latestCF := store.GetCloudflareConfig()
-			d, err := service.NewDNSService(latestCF)
-			if err != nil {
-				log.Printf("Failed to init DNS service for scheduled switch: %v", err)
-				continue
-			}
-			if err := d.UpdateRecordBySubdomain(ctx, m.Config.ZoneID, sub, toIP, proxied); err != nil {
-				log.Printf("Failed to update DNS for %s: %v", sub, err)
-			}
+		if ctx.Err() != nil {
+			log.Printf("Monitor %s stopped, dropping scheduled DNS switch", m.Config.Name)
+			return
+		}
+		if err := dnsOutbox.Enqueue(m.Config, toIP, proxied, "schedule"); err != nil {
+			log.Printf("Failed to queue DNS switch for %s: %v", m.Config.Name, err)
 		}
 	}
-	engine.OnIPDown = func(m *monitor.Monitor, ip, role string) {
+	engine.OnStateChange = func(id string, st config.MonitorState) {
+		if err := store.PutMonitorState(id, st); err != nil {
+			log.Printf("Failed to save monitor state: %v", err)
+		}
+	}
+	engine.OnIPDown = func(_ context.Context, m *monitor.Monitor, ip, role string) {
 		_ = store.AppendIPDownEvent(config.IPDownEvent{
 			Timestamp: time.Now().UnixMilli(),
 			MonitorID: m.Config.ID,
@@ -184,11 +220,75 @@ func main() {
 		}, 2000)
 	}
 
+	engine.OnNetworkImpaired = func(_ context.Context, impaired bool) {
+		msg := "监控主机网络已恢复，所有基准探测目标可达，恢复故障切换"
+		if impaired {
+			msg = "监控主机网络异常：所有基准探测目标均不可达，已暂停全部故障切换"
+		}
+		log.Println(msg)
+		service.NewNotificationService(store.GetDingTalkConfig(), store.GetEmailConfig(), store.GetTelegramConfig()).Notify(msg)
+	}
+
+	engine.OnQuorumUnavailable = func(_ context.Context, m *monitor.Monitor, unavailable bool, voters, required int) {
+		msg := fmt.Sprintf("多地仲裁已恢复：%s 有 %d 个位置上报探测结果", m.Config.Name, voters)
+		if unavailable {
+			msg = fmt.Sprintf("多地仲裁不可用：%s 仅 %d 个位置上报有效结果（需要 %d 个），暂按本机探测结果判断", m.Config.Name, voters, required)
+		}
+		log.Println(msg)
+		service.NewNotificationService(store.GetDingTalkConfig(), store.GetEmailConfig(), store.GetTelegramConfig()).Notify(msg)
+	}
+
+	engine.OnSwitchHeld = func(_ context.Context, m *monitor.Monitor, toBackup bool) {
+		msg := fmt.Sprintf("切换熔断：%s 故障切换已暂停，短时间内切换次数过多，请确认后再执行", m.Config.Name)
+		log.Println(msg)
+		service.NewNotificationService(store.GetDingTalkConfig(), store.GetEmailConfig(), store.GetTelegramConfig()).Notify(msg)
+	}
+
+	engine.OnOriginalRecovered = func(_ context.Context, m *monitor.Monitor) {
+		msg := fmt.Sprintf("服务器 %s 原始 IP %s 已恢复健康，恢复策略为 %s，请确认后执行恢复", m.Config.Name, m.Config.OriginalIP, m.Config.RestorePolicy)
+		log.Println(msg)
+		service.NewNotificationService(store.GetDingTalkConfig(), store.GetEmailConfig(), store.GetTelegramConfig()).Notify(msg)
+	}
+
+	// ctx 为监控上下文，进行中的 DNS 更新依赖它；schedCtx 仅控制调度器与基准探测，关闭时先停止
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-
+	schedCtx, stopSched := context.WithCancel(ctx)
+	defer stopSched()
+
+	engine.Start(schedCtx)
+	// 监控状态由独立的写入协程合并落盘，引擎切换时无需等待数据文件写入
+	go store.RunStateFlusher(ctx)
+	reconciler := drift.New(engine, store, dnsOutbox)
+	// 更新生效后向公共解析器确认新地址已可见
+	verifier := propagation.New(ctx, store)
+	dnsOutbox.OnApplied = func(_ context.Context, e config.OutboxEntry, m config.MonitorConfig, results []service.RecordResult) {
+		verifier.Start(e, m, results)
+	}
+	outboxDone := make(chan struct{})
+	go func() {
+		dnsOutbox.Run(ctx)
+		close(outboxDone)
+	}()
+	go engine.RunCanaries(schedCtx)
+	// 按上次保存的切换状态恢复监控，已故障切换的监控重启后仍保持在备用 IP
 	for _, mCfg := range store.ListMonitors() {
-		engine.StartMonitor(ctx, mCfg)
+		if st, ok := store.GetMonitorState(mCfg.ID); ok {
+			engine.ResumeMonitor(ctx, mCfg, st)
+		} else {
+			engine.StartMonitor(ctx, mCfg)
+		}
+	}
+	// 漂移检测依赖恢复后的监控状态，须在上面的恢复完成后启动
+	go reconciler.Run(schedCtx)
+
+	// 内置权威 DNS 服务
+	var dnsSrv *dnsserver.Server
+	if dnsCfg := store.GetDNSServerConfig(); dnsCfg.Enabled {
+		dnsSrv = dnsserver.New(engine, store, dnsCfg)
+		if err := dnsSrv.Start(); err != nil {
+			log.Fatalf("Failed to start DNS server: %v", err)
+		}
 	}
 
 	// 启动 API 服务
@@ -213,15 +313,16 @@ func main() {
 	r.StaticFile("/app.js", "./web/app.js")
 	r.StaticFile("/favicon.ico", "./web/favicon.ico")
 
-	handler := api.NewHandler(engine, store, ctx)
+	handler := api.NewHandler(engine, store, dnsOutbox, reconciler, ctx)
 	handler.RegisterRoutes(r)
 
+	port := cfg.Server.Port
+	if port == 0 {
+		port = 8081
+	}
+	srv := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: r}
 	go func() {
-		port := cfg.Server.Port
-		if port == 0 {
-			port = 8081
-		}
-		if err := r.Run(fmt.Sprintf(":%d", port)); err != nil {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("Failed to run server: %v", err)
 		}
 	}()
@@ -233,4 +334,49 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutting down...")
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+
+	// 1. 停止接收 API 请求，等待处理中的请求完成
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("API server shutdown: %v", err)
+	}
+	if dnsSrv != nil {
+		if err := dnsSrv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("DNS server shutdown: %v", err)
+		}
+	}
+	// 2. 停止调度器，等待进行中的检查、DNS 更新与通知完成
+	stopSched()
+	if err := engine.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Timed out waiting for pending switches: %v", err)
+	}
+	if err := dnsOutbox.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Timed out waiting for DNS updates, they will be retried after restart: %v", err)
+	}
+	cancel()
+	<-outboxDone
+	// 3. 持久化状态
+	if err := store.Save(); err != nil {
+		log.Printf("Failed to save config: %v", err)
+	}
+	log.Println("Shutdown complete")
+}
+
+func runAgent(serverURL, token string) {
+	if serverURL == "" || token == "" {
+		log.Fatal("代理模式需要同时指定 -server 和 -agent-token")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go agent.New(serverURL, token).Run(ctx)
+	log.Printf("Probe agent started, reporting to %s", serverURL)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down...")
 }
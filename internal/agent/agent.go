@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"dns-failover/internal/config"
+	"dns-failover/internal/monitor"
+)
+
+// Agent runs the monitor checkers from a remote location and reports results to the main server.
+type Agent struct {
+	serverURL string
+	token     string
+	client    *http.Client
+
+	mu       sync.Mutex
+	monitors map[string]config.MonitorConfig
+	nextRun  map[string]time.Time
+}
+
+func New(serverURL, token string) *Agent {
+	return &Agent{
+		serverURL: strings.TrimRight(serverURL, "/"),
+		token:     token,
+		client:    &http.Client{Timeout: 15 * time.Second},
+		monitors:  make(map[string]config.MonitorConfig),
+		nextRun:   make(map[string]time.Time),
+	}
+}
+
+// Run probes due monitors every second and refreshes the monitor list every minute until ctx is done.
+func (a *Agent) Run(ctx context.Context) {
+	refresh := time.NewTicker(time.Minute)
+	defer refresh.Stop()
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+
+	a.refresh(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-refresh.C:
+			a.refresh(ctx)
+		case <-tick.C:
+			a.runDue(ctx)
+		}
+	}
+}
+
+func (a *Agent) refresh(ctx context.Context) {
+	var resp struct {
+		Code int                    `json:"code"`
+		Msg  string                 `json:"msg"`
+		Data []config.MonitorConfig `json:"data"`
+	}
+	if err := a.do(ctx, http.MethodGet, "/api/agent/monitors", nil, &resp); err != nil {
+		log.Printf("Agent: failed to fetch monitors: %v", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	seen := make(map[string]bool, len(resp.Data))
+	for _, m := range resp.Data {
+		seen[m.ID] = true
+		a.monitors[m.ID] = m
+		if _, ok := a.nextRun[m.ID]; !ok {
+			a.nextRun[m.ID] = time.Now()
+		}
+	}
+	for id := range a.monitors {
+		if !seen[id] {
+			delete(a.monitors, id)
+			delete(a.nextRun, id)
+		}
+	}
+}
+
+func (a *Agent) runDue(ctx context.Context) {
+	now := time.Now()
+	due := make([]config.MonitorConfig, 0)
+
+	a.mu.Lock()
+	for id, m := range a.monitors {
+		if now.Before(a.nextRun[id]) {
+			continue
+		}
+		interval := m.Interval
+		if interval <= 0 {
+			interval = 60
+		}
+		a.nextRun[id] = now.Add(time.Duration(interval) * time.Second)
+		due = append(due, m)
+	}
+	a.mu.Unlock()
+
+	if len(due) == 0 {
+		return
+	}
+
+	go func() {
+		results := make([]monitor.AgentResult, len(due))
+		var wg sync.WaitGroup
+		for i, m := range due {
+			wg.Add(1)
+			go func(i int, m config.MonitorConfig) {
+				defer wg.Done()
+				results[i] = monitor.AgentResult{
+					MonitorID: m.ID,
+					Success:   monitor.ProbeWithRetries(ctx, m),
+					CheckedAt: time.Now().UnixMilli(),
+				}
+			}(i, m)
+		}
+		wg.Wait()
+
+		if err := a.do(ctx, http.MethodPost, "/api/agent/report", map[string]interface{}{"results": results}, nil); err != nil {
+			log.Printf("Agent: failed to report %d results: %v", len(results), err)
+		}
+	}()
+}
+
+func (a *Agent) do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, a.serverURL+path, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned status %d", resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"dns-failover/internal/config"
+	"dns-failover/internal/monitor"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 探测代理 ---
+
+// AgentAuthMiddleware 代理认证中间件，校验 Authorization: Bearer <token>
+func (h *Handler) AgentAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		var agent config.AgentConfig
+		if ok {
+			agent, ok = h.store.GetAgentByToken(strings.TrimSpace(token))
+		}
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "msg": "invalid agent token"})
+			c.Abort()
+			return
+		}
+		c.Set("agent", agent)
+		c.Next()
+	}
+}
+
+// agentMonitor 是代理探测所需的监控字段，DNS、通知等其余配置不下发给代理
+type agentMonitor struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	CheckType         string `json:"check_type"`
+	CheckTarget       string `json:"check_target"`
+	OriginalIP        string `json:"original_ip"`
+	PingCount         int    `json:"ping_count"`
+	Interval          int    `json:"interval"`
+	TimeoutSeconds    int    `json:"timeout_seconds"`
+	Retries           int    `json:"retries"`
+	RetryDelaySeconds int    `json:"retry_delay_seconds"`
+}
+
+// AgentListMonitors 返回代理需要探测的监控列表
+func (h *Handler) AgentListMonitors(c *gin.Context) {
+	monitors := make([]agentMonitor, 0)
+	for _, m := range h.store.ListMonitors() {
+		// 推送监控由源站主动上报心跳，代理无法探测
+		if m.CheckType == "push" {
+			continue
+		}
+		monitors = append(monitors, agentMonitor{
+			ID:                m.ID,
+			Name:              m.Name,
+			CheckType:         m.CheckType,
+			CheckTarget:       m.CheckTarget,
+			OriginalIP:        m.OriginalIP,
+			PingCount:         m.PingCount,
+			Interval:          m.Interval,
+			TimeoutSeconds:    m.TimeoutSeconds,
+			Retries:           m.Retries,
+			RetryDelaySeconds: m.RetryDelaySeconds,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": monitors})
+}
+
+// AgentReport 接收代理上报的探测结果
+func (h *Handler) AgentReport(c *gin.Context) {
+	var req struct {
+		Results []monitor.AgentResult `json:"results"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	agent := c.MustGet("agent").(config.AgentConfig)
+	h.engine.ReportAgentResults(agent, req.Results)
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
+}
+
+func (h *Handler) ListAgents(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": h.store.ListAgents()})
+}
+
+func (h *Handler) AddAgent(c *gin.Context) {
+	var agent config.AgentConfig
+	if err := c.ShouldBindJSON(&agent); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	if agent.ID == "" {
+		agent.ID = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	if agent.Token == "" {
+		agent.Token = GenerateToken()
+	}
+	if err := h.store.UpsertAgent(agent); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": agent})
+}
+
+func (h *Handler) DeleteAgent(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.store.DeleteAgent(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+		return
+	}
+	h.engine.ForgetAgent(id)
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
+}
+
+func (h *Handler) GetQuorum(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": h.store.GetQuorumConfig()})
+}
+
+func (h *Handler) UpdateQuorum(c *gin.Context) {
+	var q config.QuorumConfig
+	if err := c.ShouldBindJSON(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	if err := h.store.UpdateQuorumConfig(q); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+		return
+	}
+	h.engine.SetQuorum(q)
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
+}
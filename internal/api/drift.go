@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+
+	"dns-failover/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) GetDrift(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": gin.H{"config": h.store.GetDriftConfig(), "reports": h.drift.Reports()}})
+}
+
+func (h *Handler) UpdateDrift(c *gin.Context) {
+	var cfg config.DriftConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	if err := h.store.UpdateDriftConfig(cfg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
+}
+
+// CheckDrift 立即检查所有监控的解析记录是否与预期一致
+func (h *Handler) CheckDrift(c *gin.Context) {
+	h.drift.CheckAll(c.Request.Context())
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": h.drift.Reports()})
+}
@@ -12,25 +12,28 @@ import (
 	"time"
 
 	"dns-failover/internal/config"
+	"dns-failover/internal/drift"
 	"dns-failover/internal/monitor"
+	"dns-failover/internal/outbox"
 	"dns-failover/internal/service"
 
-	"github.com/cloudflare/cloudflare-go"
 	"github.com/gin-gonic/gin"
 )
 
 type Handler struct {
 	engine    *monitor.Engine
 	store     *config.Store
+	outbox    *outbox.Outbox
+	drift     *drift.Reconciler
 	rootCtx   context.Context
 	startedAt time.Time
 }
 
-func NewHandler(engine *monitor.Engine, store *config.Store, rootCtx context.Context) *Handler {
+func NewHandler(engine *monitor.Engine, store *config.Store, dnsOutbox *outbox.Outbox, reconciler *drift.Reconciler, rootCtx context.Context) *Handler {
 	if rootCtx == nil {
 		rootCtx = context.Background()
 	}
-	return &Handler{engine: engine, store: store, rootCtx: rootCtx, startedAt: time.Now()}
+	return &Handler{engine: engine, store: store, outbox: dnsOutbox, drift: reconciler, rootCtx: rootCtx, startedAt: time.Now()}
 }
 
 func (h *Handler) RegisterRoutes(r *gin.Engine) {
@@ -41,6 +44,20 @@ func (h *Handler) RegisterRoutes(r *gin.Engine) {
 		api.GET("/auth/check", h.CheckAuth)
 		api.GET("/auth/status", h.AuthStatus)
 
+		// 推送监控心跳（使用监控的 push_token 认证）
+		api.POST("/heartbeat/:token", h.Heartbeat)
+
+		// 外部告警（Alertmanager / Grafana / 通用 JSON），使用 webhook 令牌认证
+		api.POST("/webhook/alerts", h.WebhookAuthMiddleware(), h.InboundAlert)
+
+		// 探测代理上报（使用代理令牌认证）
+		agent := api.Group("/agent")
+		agent.Use(h.AgentAuthMiddleware())
+		{
+			agent.GET("/monitors", h.AgentListMonitors)
+			agent.POST("/report", h.AgentReport)
+		}
+
 		// 需要认证的路由
 		authenticated := api.Group("")
 		authenticated.Use(h.AuthMiddleware())
@@ -48,7 +65,7 @@ func (h *Handler) RegisterRoutes(r *gin.Engine) {
 			// 状态总览
 			authenticated.GET("/status", h.GetStatus)
 
-			// 域名管理 (Cloudflare)
+			// 域名管理（默认使用当前 Cloudflare 凭证，?provider_id= 指定其他 DNS 提供商）
 			authenticated.GET("/zones", h.ListZones)
 			authenticated.GET("/zones/:id/records", h.ListRecords)
 			authenticated.POST("/zones/:id/records", h.CreateRecord)
@@ -61,6 +78,7 @@ func (h *Handler) RegisterRoutes(r *gin.Engine) {
 			authenticated.PUT("/monitors/:id", h.UpdateMonitor)
 			authenticated.DELETE("/monitors/:id", h.DeleteMonitor)
 			authenticated.POST("/monitors/:id/restore", h.RestoreMonitor)
+			authenticated.POST("/monitors/:id/approve-restore", h.ApproveRestore)
 
 			// 全局配置
 			authenticated.GET("/config", h.GetGlobalConfig)
@@ -72,6 +90,48 @@ func (h *Handler) RegisterRoutes(r *gin.Engine) {
 			authenticated.PUT("/cloudflare-accounts/:id", h.UpdateCloudflareAccount)
 			authenticated.DELETE("/cloudflare-accounts/:id", h.DeleteCloudflareAccount)
 			authenticated.POST("/cloudflare-accounts/:id/activate", h.ActivateCloudflareAccount)
+
+			// DNS 提供商
+			authenticated.GET("/dns-providers", h.ListDNSProviders)
+			authenticated.POST("/dns-providers", h.AddDNSProvider)
+			authenticated.DELETE("/dns-providers/:id", h.DeleteDNSProvider)
+
+			// 探测代理与仲裁
+			authenticated.GET("/agents", h.ListAgents)
+			authenticated.POST("/agents", h.AddAgent)
+			authenticated.DELETE("/agents/:id", h.DeleteAgent)
+			authenticated.GET("/quorum", h.GetQuorum)
+			authenticated.POST("/quorum", h.UpdateQuorum)
+
+			// 本机网络自检（基准探测目标）
+			authenticated.GET("/canaries", h.GetCanaries)
+			authenticated.POST("/canaries", h.UpdateCanaries)
+
+			// 全局切换熔断
+			authenticated.GET("/circuit-breaker", h.GetCircuitBreaker)
+			authenticated.POST("/circuit-breaker", h.UpdateCircuitBreaker)
+			authenticated.GET("/held-switches", h.ListHeldSwitches)
+			authenticated.POST("/held-switches/:id/confirm", h.ConfirmHeldSwitch)
+			authenticated.POST("/held-switches/:id/discard", h.DiscardHeldSwitch)
+
+			// 外部告警 webhook 配置
+			authenticated.GET("/inbound-webhook", h.GetInboundWebhook)
+			authenticated.POST("/inbound-webhook", h.UpdateInboundWebhook)
+
+			// 待执行的 DNS 更新队列与重试配置
+			authenticated.GET("/outbox", h.ListOutbox)
+			authenticated.DELETE("/outbox/:id", h.DiscardOutboxEntry)
+			authenticated.GET("/dns-retry", h.GetDNSRetry)
+			authenticated.POST("/dns-retry", h.UpdateDNSRetry)
+
+			// DNS 漂移检测
+			authenticated.GET("/drift", h.GetDrift)
+			authenticated.POST("/drift", h.UpdateDrift)
+			authenticated.POST("/drift/check", h.CheckDrift)
+
+			// 切换后的 DNS 传播验证
+			authenticated.GET("/propagation", h.GetPropagation)
+			authenticated.POST("/propagation", h.UpdatePropagation)
 		}
 	}
 }
@@ -198,16 +258,8 @@ func GenerateToken() string {
 
 // --- 域名管理 ---
 
-func (h *Handler) getDNSService() (*service.DNSService, error) {
-	cfg := h.store.GetCloudflareConfig()
-	if cfg.APIToken == "" && (cfg.APIKey == "" || cfg.Email == "") {
-		return nil, fmt.Errorf("Cloudflare credentials not configured (api_token OR api_key+email required)")
-	}
-	return service.NewDNSService(cfg)
-}
-
 func (h *Handler) ListZones(c *gin.Context) {
-	svc, err := h.getDNSService()
+	svc, err := h.getDNSProvider(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
 		return
@@ -221,7 +273,7 @@ func (h *Handler) ListZones(c *gin.Context) {
 }
 
 func (h *Handler) ListRecords(c *gin.Context) {
-	svc, err := h.getDNSService()
+	svc, err := h.getDNSProvider(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
 		return
@@ -236,13 +288,13 @@ func (h *Handler) ListRecords(c *gin.Context) {
 }
 
 func (h *Handler) CreateRecord(c *gin.Context) {
-	svc, err := h.getDNSService()
+	svc, err := h.getDNSProvider(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
 		return
 	}
 	zoneID := c.Param("id")
-	var params cloudflare.CreateDNSRecordParams
+	var params service.Record
 	if err := c.ShouldBindJSON(&params); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
 		return
@@ -256,14 +308,14 @@ func (h *Handler) CreateRecord(c *gin.Context) {
 }
 
 func (h *Handler) UpdateRecord(c *gin.Context) {
-	svc, err := h.getDNSService()
+	svc, err := h.getDNSProvider(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
 		return
 	}
 	zoneID := c.Param("id")
 	recordID := c.Param("record_id")
-	var params cloudflare.UpdateDNSRecordParams
+	var params service.Record
 	if err := c.ShouldBindJSON(&params); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
 		return
@@ -278,7 +330,7 @@ func (h *Handler) UpdateRecord(c *gin.Context) {
 }
 
 func (h *Handler) DeleteRecord(c *gin.Context) {
-	svc, err := h.getDNSService()
+	svc, err := h.getDNSProvider(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
 		return
@@ -311,12 +363,29 @@ func (h *Handler) AddMonitor(c *gin.Context) {
 	if m.CheckType == "" {
 		m.CheckType = "ping"
 	}
-	if err := h.store.UpsertMonitor(m); err != nil {
+	if m.CheckType == "push" && m.PushToken == "" {
+		m.PushToken = GenerateToken()
+	}
+	if err := h.validateParents(m); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	h.bindAccount(&m)
+	if err := h.validateProvider(m); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	warnings, err := h.checkMonitorDNS(c.Request.Context(), &m)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	if err := h.store.UpsertMonitor(&m); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
 		return
 	}
 	h.engine.StartMonitor(h.rootCtx, m)
-	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success", "data": gin.H{"zone_id": m.ZoneID, "warnings": warnings}})
 }
 
 func (h *Handler) UpdateMonitor(c *gin.Context) {
@@ -329,24 +398,104 @@ func (h *Handler) UpdateMonitor(c *gin.Context) {
 	if m.CheckType == "" {
 		m.CheckType = "ping"
 	}
-	if err := h.store.UpsertMonitor(m); err != nil {
+	if m.CheckType == "push" && m.PushToken == "" {
+		// 保留已有的心跳令牌，避免编辑后推送端失效
+		if existing, ok := h.store.GetMonitor(m.ID); ok && existing.PushToken != "" {
+			m.PushToken = existing.PushToken
+		} else {
+			m.PushToken = GenerateToken()
+		}
+	}
+	if err := h.validateParents(m); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	h.bindAccount(&m)
+	if err := h.validateProvider(m); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	warnings, err := h.checkMonitorDNS(c.Request.Context(), &m)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	if err := h.store.UpsertMonitor(&m); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
 		return
 	}
 	h.engine.StartMonitor(h.rootCtx, m)
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success", "data": gin.H{"zone_id": m.ZoneID, "warnings": warnings}})
+}
+
+// validateParents 检查父监控是否存在且依赖关系中没有环
+func (h *Handler) validateParents(m config.MonitorConfig) error {
+	parents := make(map[string][]string)
+	for _, item := range h.store.ListMonitors() {
+		parents[item.ID] = item.ParentIDs
+	}
+	parents[m.ID] = m.ParentIDs
+
+	for _, pid := range m.ParentIDs {
+		if pid == m.ID {
+			return fmt.Errorf("monitor cannot be its own parent")
+		}
+		if _, ok := parents[pid]; !ok {
+			return fmt.Errorf("parent monitor %s not found", pid)
+		}
+	}
+
+	// 从当前监控出发沿父链遍历，若回到自身则存在环
+	visited := make(map[string]bool)
+	stack := append([]string(nil), m.ParentIDs...)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id == m.ID {
+			return fmt.Errorf("parent_ids would create a dependency cycle")
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		stack = append(stack, parents[id]...)
+	}
+	return nil
+}
+
+// Heartbeat 接收推送监控的心跳
+func (h *Handler) Heartbeat(c *gin.Context) {
+	if !h.engine.Heartbeat(c.Param("token")) {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "monitor not found"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
 }
 
 func (h *Handler) DeleteMonitor(c *gin.Context) {
 	id := c.Param("id")
-	if err := h.store.DeleteMonitor(id); err != nil {
+	dependents, err := h.store.DeleteMonitor(id)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
 		return
 	}
 	h.engine.StopMonitor(id)
+	// 从依赖它的子监控中移除该父监控，并按当前切换状态重启
+	for _, m := range dependents {
+		h.restartMonitor(m)
+	}
 	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
 }
 
+// restartMonitor 以新配置重启监控，并保留其当前的切换状态
+func (h *Handler) restartMonitor(m config.MonitorConfig) {
+	if st, ok := h.store.GetMonitorState(m.ID); ok {
+		h.engine.ResumeMonitor(h.rootCtx, m, st)
+	} else {
+		h.engine.StartMonitor(h.rootCtx, m)
+	}
+}
+
 // --- 全局配置 ---
 
 func (h *Handler) GetGlobalConfig(c *gin.Context) {
@@ -399,7 +548,7 @@ func (h *Handler) RestoreMonitor(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "monitor not found"})
 		return
 	}
-	if mCfg.ZoneID == "" {
+	if mCfg.ZoneID == "" && service.NeedsZone(mCfg) {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "zone_id is required"})
 		return
 	}
@@ -414,20 +563,7 @@ func (h *Handler) RestoreMonitor(c *gin.Context) {
 		proxied = *req.Proxied
 	}
 
-	d, err := h.getDNSService()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
-		return
-	}
-
-	ctx := c.Request.Context()
-	for _, sub := range mCfg.Subdomains {
-		if err := d.UpdateRecordBySubdomain(ctx, mCfg.ZoneID, sub, mCfg.OriginalIP, proxied); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
-			return
-		}
-	}
-
+	// 先记录切换事件，传播验证在更新生效后即开始，需要能找到这条事件
 	_ = h.store.AppendSwitchEvent(config.SwitchEvent{
 		Timestamp: time.Now().UnixMilli(),
 		MonitorID: mCfg.ID,
@@ -439,10 +575,28 @@ func (h *Handler) RestoreMonitor(c *gin.Context) {
 		Reason:    "restore",
 	}, 200)
 
+	// 失败的更新保留在队列中自动重试
+	results, err := h.outbox.ApplyNow(c.Request.Context(), mCfg, mCfg.OriginalIP, proxied, "restore")
+	if err != nil {
+		_ = h.store.SetSwitchApplyError(mCfg.ID, mCfg.OriginalIP, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error(), "data": gin.H{"records": results}})
+		return
+	}
+
 	msg := fmt.Sprintf("手动恢复：%s 切回主 IP: %s", mCfg.Name, mCfg.OriginalIP)
 	service.NewNotificationService(h.store.GetDingTalkConfig(), h.store.GetEmailConfig(), h.store.GetTelegramConfig()).Notify(msg)
 
-	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success", "data": gin.H{"records": results}})
+}
+
+// ApproveRestore 批准 auto-after-approval 策略的监控自动切回主 IP
+func (h *Handler) ApproveRestore(c *gin.Context) {
+	restored, err := h.engine.ApproveRestore(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success", "data": gin.H{"restored": restored}})
 }
 
 func (h *Handler) GetStatus(c *gin.Context) {
@@ -518,10 +672,75 @@ func (h *Handler) GetStatus(c *gin.Context) {
 			"history":     history,
 			"system":      system,
 			"offline_hot": offlineHot,
+			"agents":      h.engine.AgentStatus(),
+			"network":     h.engine.NetworkStatus(),
+			"breaker":     h.engine.BreakerStatus(),
+			"scheduler":   h.engine.SchedulerStatus(),
+			"drift":       h.drift.Reports(),
 		},
 	})
 }
 
+// --- 本机网络自检 ---
+
+func (h *Handler) GetCanaries(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": h.store.GetCanaryConfig()})
+}
+
+func (h *Handler) UpdateCanaries(c *gin.Context) {
+	var cfg config.CanaryConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	if err := h.store.UpdateCanaryConfig(cfg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+		return
+	}
+	h.engine.SetCanaries(cfg)
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
+}
+
+// --- 全局切换熔断 ---
+
+func (h *Handler) GetCircuitBreaker(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": h.store.GetCircuitBreakerConfig()})
+}
+
+func (h *Handler) UpdateCircuitBreaker(c *gin.Context) {
+	var cfg config.CircuitBreakerConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	if err := h.store.UpdateCircuitBreakerConfig(cfg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+		return
+	}
+	h.engine.SetCircuitBreaker(cfg)
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
+}
+
+func (h *Handler) ListHeldSwitches(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": h.engine.HeldSwitches()})
+}
+
+func (h *Handler) ConfirmHeldSwitch(c *gin.Context) {
+	if err := h.engine.ConfirmHeldSwitch(c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
+}
+
+func (h *Handler) DiscardHeldSwitch(c *gin.Context) {
+	if err := h.engine.DiscardHeldSwitch(c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
+}
+
 // --- Cloudflare 凭证管理 ---
 
 func (h *Handler) ListCloudflareAccounts(c *gin.Context) {
@@ -569,6 +788,12 @@ func (h *Handler) UpdateCloudflareAccount(c *gin.Context) {
 
 func (h *Handler) DeleteCloudflareAccount(c *gin.Context) {
 	id := c.Param("id")
+	for _, m := range h.store.ListMonitors() {
+		if m.AccountID == id {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": fmt.Sprintf("Cloudflare account is used by monitor %s", m.Name)})
+			return
+		}
+	}
 	if err := h.store.DeleteCloudflareAccount(id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
 		return
@@ -578,6 +803,15 @@ func (h *Handler) DeleteCloudflareAccount(c *gin.Context) {
 
 func (h *Handler) ActivateCloudflareAccount(c *gin.Context) {
 	id := c.Param("id")
+	// 先将尚未绑定账户的监控绑定到原激活账户，切换激活账户不应改变它们使用的账户
+	bound, err := h.store.BindUnboundMonitors()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+		return
+	}
+	for _, m := range bound {
+		h.restartMonitor(m)
+	}
 	if err := h.store.ActivateCloudflareAccount(id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
 		return
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+
+	"dns-failover/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListOutbox 列出尚未生效、等待重试的 DNS 更新
+func (h *Handler) ListOutbox(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": h.store.ListOutbox()})
+}
+
+// DiscardOutboxEntry 放弃一条待重试的 DNS 更新
+func (h *Handler) DiscardOutboxEntry(c *gin.Context) {
+	if err := h.outbox.Discard(c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
+}
+
+func (h *Handler) GetDNSRetry(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": h.store.GetDNSRetryConfig()})
+}
+
+func (h *Handler) UpdateDNSRetry(c *gin.Context) {
+	var cfg config.DNSRetryConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	if err := h.store.UpdateDNSRetryConfig(cfg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
+}
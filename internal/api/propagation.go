@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+
+	"dns-failover/internal/config"
+	"dns-failover/internal/propagation"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) GetPropagation(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": h.store.GetPropagationConfig()})
+}
+
+func (h *Handler) UpdatePropagation(c *gin.Context) {
+	var cfg config.PropagationConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	for _, r := range cfg.Resolvers {
+		if _, err := propagation.ResolverAddr(r); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+			return
+		}
+	}
+	if err := h.store.UpdatePropagationConfig(cfg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
+}
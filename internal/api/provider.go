@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"dns-failover/internal/config"
+	"dns-failover/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getDNSProvider returns the provider selected by ?provider_id=, or the Cloudflare account selected by
+// ?account_id=, falling back to the active account.
+func (h *Handler) getDNSProvider(c *gin.Context) (service.DNSProvider, error) {
+	return service.ProviderForAccount(h.store, c.Query("provider_id"), c.Query("account_id"))
+}
+
+// validateProvider 检查监控引用的 DNS 提供商是否存在，以及切换动作的配置是否完整
+func (h *Handler) validateProvider(m config.MonitorConfig) error {
+	switch m.Action {
+	case "", service.ActionDNS:
+	case service.ActionLBPool:
+		if err := service.ValidateLBPool(m); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported action %q", m.Action)
+	}
+	if m.RecordID != "" && len(m.Subdomains) > 1 {
+		return fmt.Errorf("record_id can only be used with a single subdomain")
+	}
+
+	if m.ProviderID == "" {
+		if m.AccountID != "" {
+			if _, ok := h.store.GetCloudflareAccountConfig(m.AccountID); !ok {
+				return fmt.Errorf("Cloudflare account %s not found", m.AccountID)
+			}
+		}
+		return nil
+	}
+	if m.AccountID != "" {
+		return fmt.Errorf("account_id cannot be combined with provider_id")
+	}
+	p, ok := h.store.GetDNSProvider(m.ProviderID)
+	if !ok {
+		return fmt.Errorf("DNS provider %s not found", m.ProviderID)
+	}
+	if m.Action == service.ActionLBPool && p.Type != service.ProviderCloudflare && p.Type != "" {
+		return fmt.Errorf("lb_pool action requires a Cloudflare provider")
+	}
+	return nil
+}
+
+// bindAccount 将未指定 provider_id 与 account_id 的监控绑定到当前激活的 Cloudflare 账户，
+// 之后切换激活账户不会改变该监控故障切换、恢复与浏览域名所用的账户
+func (h *Handler) bindAccount(m *config.MonitorConfig) {
+	if m.ProviderID == "" && m.AccountID == "" {
+		m.AccountID = h.store.ActiveCloudflareAccountID()
+	}
+}
+
+// checkMonitorDNS 在 zone_id 为空时按子域名自动匹配 zone，并检查每个子域名是否存在可切换的解析记录。
+// 无法确定 zone、子域名不属于该 zone、记录不存在或类型不兼容时拒绝保存；已有 zone_id 时提供商暂时无法访问、
+// 或记录将在切换时创建时只返回警告
+func (h *Handler) checkMonitorDNS(ctx context.Context, m *config.MonitorConfig) ([]string, error) {
+	if !service.NeedsZone(*m) || len(m.Subdomains) == 0 {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+
+	p, err := service.ProviderForMonitor(h.store, *m)
+	if err != nil {
+		if m.ZoneID == "" {
+			return nil, fmt.Errorf("zone not resolved: %w", err)
+		}
+		return []string{fmt.Sprintf("DNS records not checked: %v", err)}, nil
+	}
+
+	if m.ZoneID == "" {
+		zone, err := service.ResolveZone(ctx, p, m.Subdomains[0])
+		if err != nil {
+			if errors.Is(err, service.ErrNoZone) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("zone not resolved, set zone_id or retry: %w", err)
+		}
+		for _, sub := range m.Subdomains[1:] {
+			if !service.InZone(sub, zone.Name) {
+				return nil, fmt.Errorf("subdomain %s is not in zone %s", sub, zone.Name)
+			}
+		}
+		m.ZoneID = zone.ID
+	}
+
+	if _, builtin := p.(*service.BuiltinProvider); builtin {
+		return nil, nil // the built-in server answers from monitor state and has no records to check
+	}
+
+	var types []string
+	for _, ip := range []string{m.OriginalIP, m.BackupIP} {
+		if ip == "" {
+			continue
+		}
+		if typ := service.TargetType(ip, m.RecordType); !slices.Contains(types, typ) {
+			types = append(types, typ)
+		}
+	}
+
+	var warnings []string
+	for _, sub := range m.Subdomains {
+		for _, typ := range types {
+			records, err := p.LookupRecords(ctx, m.ZoneID, sub, typ, m.RecordLine)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s: records not checked: %v", sub, err))
+				continue
+			}
+			if len(service.MatchRecords(records, typ, m.RecordID)) > 0 {
+				continue
+			}
+			switch {
+			case m.RecordID != "":
+				return nil, fmt.Errorf("DNS record %s not found for %s (type %s)", m.RecordID, sub, typ)
+			case m.CreateIfMissing:
+				warnings = append(warnings, fmt.Sprintf("%s: no %s record yet, it will be created on switch", sub, typ))
+			default:
+				return nil, fmt.Errorf("no %s record found for %s", typ, sub)
+			}
+		}
+	}
+	return warnings, nil
+}
+
+func (h *Handler) ListDNSProviders(c *gin.Context) {
+	providers := h.store.ListDNSProviders()
+	for i := range providers {
+		providers[i] = maskProviderSecrets(providers[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": providers})
+}
+
+// secretMask replaces stored credentials in API responses. Submitting it back keeps the stored value.
+const secretMask = "******"
+
+// providerSecrets returns pointers to the credential fields of p.
+func providerSecrets(p *config.DNSProviderConfig) []*string {
+	return []*string{&p.APIToken, &p.APIKey, &p.AccessKeySecret, &p.SecretKey, &p.TSIGSecret}
+}
+
+func maskProviderSecrets(p config.DNSProviderConfig) config.DNSProviderConfig {
+	for _, s := range providerSecrets(&p) {
+		if *s != "" {
+			*s = secretMask
+		}
+	}
+	return p
+}
+
+// unmaskProviderSecrets restores the stored credentials of fields submitted as secretMask.
+func unmaskProviderSecrets(p *config.DNSProviderConfig, stored config.DNSProviderConfig) {
+	have := providerSecrets(&stored)
+	for i, s := range providerSecrets(p) {
+		if *s == secretMask {
+			*s = *have[i]
+		}
+	}
+}
+
+// AddDNSProvider 新增或更新（按 id）DNS 提供商
+func (h *Handler) AddDNSProvider(c *gin.Context) {
+	var p config.DNSProviderConfig
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	if p.ID == "" {
+		p.ID = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	if p.Type == "" {
+		p.Type = service.ProviderCloudflare
+	}
+	if stored, ok := h.store.GetDNSProvider(p.ID); ok {
+		unmaskProviderSecrets(&p, stored)
+	}
+	if _, err := service.NewProvider(p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	if err := h.store.UpsertDNSProvider(p); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": maskProviderSecrets(p)})
+}
+
+func (h *Handler) DeleteDNSProvider(c *gin.Context) {
+	id := c.Param("id")
+	for _, m := range h.store.ListMonitors() {
+		if m.ProviderID == id {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": fmt.Sprintf("DNS provider is used by monitor %s", m.Name)})
+			return
+		}
+	}
+	if err := h.store.DeleteDNSProvider(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
+}
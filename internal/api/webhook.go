@@ -0,0 +1,159 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"dns-failover/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 外部告警 webhook ---
+
+// WebhookAuthMiddleware 校验 Authorization: Bearer <token>
+func (h *Handler) WebhookAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := h.store.GetInboundWebhookConfig()
+		if !cfg.Enabled || cfg.Token == "" {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "inbound webhook disabled"})
+			c.Abort()
+			return
+		}
+
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(cfg.Token)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "msg": "invalid webhook token"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// inboundAlert covers both the Alertmanager/Grafana payload (alerts[]) and a generic single-alert body.
+type inboundAlert struct {
+	Status string `json:"status"`
+	Alerts []struct {
+		Status string            `json:"status"`
+		Labels map[string]string `json:"labels"`
+	} `json:"alerts"`
+
+	// 通用格式：{"monitor_id": "...", "status": "firing|resolved"}
+	MonitorID string `json:"monitor_id"`
+	Monitor   string `json:"monitor"`
+}
+
+// InboundAlert 将告警映射到监控并执行切换或恢复
+func (h *Handler) InboundAlert(c *gin.Context) {
+	var req inboundAlert
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+
+	cfg := h.store.GetInboundWebhookConfig()
+	label := cfg.MatchLabel
+	if label == "" {
+		label = "cfguard_monitor"
+	}
+
+	type alertRef struct {
+		key    string
+		firing bool
+	}
+	refs := make([]alertRef, 0, len(req.Alerts)+1)
+	for _, a := range req.Alerts {
+		key := a.Labels[label]
+		if key == "" {
+			key = a.Labels["monitor_id"]
+		}
+		status := a.Status
+		if status == "" {
+			status = req.Status
+		}
+		refs = append(refs, alertRef{key: key, firing: status != "resolved"})
+	}
+	if len(req.Alerts) == 0 {
+		key := req.MonitorID
+		if key == "" {
+			key = req.Monitor
+		}
+		refs = append(refs, alertRef{key: key, firing: req.Status != "resolved"})
+	}
+
+	applied := make([]gin.H, 0)
+	unmatched := make([]string, 0)
+	errs := make([]string, 0)
+	for _, ref := range refs {
+		m, ok := h.findMonitor(ref.key)
+		if !ok {
+			unmatched = append(unmatched, ref.key)
+			continue
+		}
+
+		var (
+			switched bool
+			err      error
+		)
+		switch {
+		case ref.firing:
+			switched, err = h.engine.ExternalSwitch(m.ID, true)
+		case cfg.RestoreOnResolved:
+			switched, err = h.engine.ExternalSwitch(m.ID, false)
+		default:
+			err = h.engine.ExternalRelease(m.ID)
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		applied = append(applied, gin.H{"monitor_id": m.ID, "firing": ref.firing, "switched": switched})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"applied":   applied,
+			"unmatched": unmatched,
+			"errors":    errs,
+		},
+	})
+}
+
+// findMonitor 按 ID 或名称查找监控
+func (h *Handler) findMonitor(key string) (config.MonitorConfig, bool) {
+	if key == "" {
+		return config.MonitorConfig{}, false
+	}
+	if m, ok := h.store.GetMonitor(key); ok {
+		return m, true
+	}
+	for _, m := range h.store.ListMonitors() {
+		if m.Name == key {
+			return m, true
+		}
+	}
+	return config.MonitorConfig{}, false
+}
+
+func (h *Handler) GetInboundWebhook(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": h.store.GetInboundWebhookConfig()})
+}
+
+func (h *Handler) UpdateInboundWebhook(c *gin.Context) {
+	var cfg config.InboundWebhookConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	if cfg.Enabled && cfg.Token == "" {
+		cfg.Token = GenerateToken()
+	}
+	if err := h.store.UpdateInboundWebhookConfig(cfg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": cfg})
+}
@@ -1,16 +1,32 @@
 package config
 
 type Config struct {
-	Cloudflare         CloudflareConfig    `mapstructure:"cloudflare" json:"cloudflare"`
-	CloudflareAccounts []CloudflareAccount `mapstructure:"cloudflare_accounts" json:"cloudflare_accounts"`
-	ActiveAccountIndex int                 `mapstructure:"active_account_index" json:"active_account_index"`
-	DingTalk           DingTalkConfig      `mapstructure:"dingtalk" json:"dingtalk"`
-	Email              EmailConfig         `mapstructure:"email" json:"email"`
-	Telegram           TelegramConfig      `mapstructure:"telegram" json:"telegram"`
-	Monitors           []MonitorConfig     `mapstructure:"monitors" json:"monitors"`
-	Server             ServerConfig        `mapstructure:"server" json:"server"`
-	History            []SwitchEvent       `mapstructure:"history" json:"history"`
-	IPDown             []IPDownEvent       `mapstructure:"ip_down" json:"ip_down"`
+	Cloudflare         CloudflareConfig     `mapstructure:"cloudflare" json:"cloudflare"`
+	CloudflareAccounts []CloudflareAccount  `mapstructure:"cloudflare_accounts" json:"cloudflare_accounts"`
+	DNSProviders       []DNSProviderConfig  `mapstructure:"dns_providers" json:"dns_providers"`
+	ActiveAccountIndex int                  `mapstructure:"active_account_index" json:"active_account_index"`
+	DingTalk           DingTalkConfig       `mapstructure:"dingtalk" json:"dingtalk"`
+	Email              EmailConfig          `mapstructure:"email" json:"email"`
+	Telegram           TelegramConfig       `mapstructure:"telegram" json:"telegram"`
+	Monitors           []MonitorConfig      `mapstructure:"monitors" json:"monitors"`
+	Server             ServerConfig         `mapstructure:"server" json:"server"`
+	History            []SwitchEvent        `mapstructure:"history" json:"history"`
+	IPDown             []IPDownEvent        `mapstructure:"ip_down" json:"ip_down"`
+	Agents             []AgentConfig        `mapstructure:"agents" json:"agents"`
+	Quorum             QuorumConfig         `mapstructure:"quorum" json:"quorum"`
+	Canary             CanaryConfig         `mapstructure:"canary" json:"canary"`
+	CircuitBreaker     CircuitBreakerConfig `mapstructure:"circuit_breaker" json:"circuit_breaker"`
+	InboundWebhook     InboundWebhookConfig `mapstructure:"inbound_webhook" json:"inbound_webhook"`
+	Scheduler          SchedulerConfig      `mapstructure:"scheduler" json:"scheduler"`
+	DNSServer          DNSServerConfig      `mapstructure:"dns_server" json:"dns_server"`
+	DNSRetry           DNSRetryConfig       `mapstructure:"dns_retry" json:"dns_retry"`
+	Drift              DriftConfig          `mapstructure:"drift" json:"drift"`
+	Propagation        PropagationConfig    `mapstructure:"propagation" json:"propagation"`
+	Outbox             []OutboxEntry        `mapstructure:"outbox" json:"outbox"`
+	// States holds each monitor's switching state by monitor ID (see MonitorState).
+	States map[string]MonitorState `mapstructure:"states" json:"states"`
+	// Applied holds the last target the outbox applied for each monitor, by monitor ID.
+	Applied map[string]AppliedTarget `mapstructure:"applied" json:"applied"`
 }
 
 type CloudflareConfig struct {
@@ -27,6 +43,41 @@ type CloudflareAccount struct {
 	Email    string `mapstructure:"email" json:"email"`
 }
 
+// DNSProviderConfig is a DNS backend account that monitors can fail over through. Type selects the
+// implementation ("cloudflare", "rfc2136", "powerdns", "alidns", "dnspod",
+// "builtin"); only the fields belonging to that type are used.
+type DNSProviderConfig struct {
+	ID   string `mapstructure:"id" json:"id"`
+	Name string `mapstructure:"name" json:"name"`
+	Type string `mapstructure:"type" json:"type"`
+
+	// cloudflare; APIKey is also the PowerDNS X-API-Key
+	APIToken string `mapstructure:"api_token" json:"api_token,omitempty"`
+	APIKey   string `mapstructure:"api_key" json:"api_key,omitempty"`
+	Email    string `mapstructure:"email" json:"email,omitempty"`
+
+	// powerdns: APIURL is the webserver base URL, e.g. http://127.0.0.1:8081; ServerID defaults to localhost.
+	APIURL   string `mapstructure:"api_url" json:"api_url,omitempty"`
+	ServerID string `mapstructure:"server_id" json:"server_id,omitempty"`
+
+	// alidns
+	AccessKeyID     string `mapstructure:"access_key_id" json:"access_key_id,omitempty"`
+	AccessKeySecret string `mapstructure:"access_key_secret" json:"access_key_secret,omitempty"`
+
+	// dnspod (Tencent Cloud API 3.0 credentials)
+	SecretID  string `mapstructure:"secret_id" json:"secret_id,omitempty"`
+	SecretKey string `mapstructure:"secret_key" json:"secret_key,omitempty"`
+
+	// rfc2136: Server is the primary's host[:port]. Zones lists the zones it may update, since DNS
+	// cannot enumerate them. The TSIG secret is base64; the algorithm defaults to hmac-sha256.
+	// builtin: Zones lists the zones served by the built-in DNS server.
+	Server        string   `mapstructure:"server" json:"server,omitempty"`
+	Zones         []string `mapstructure:"zones" json:"zones,omitempty"`
+	TSIGKeyName   string   `mapstructure:"tsig_key_name" json:"tsig_key_name,omitempty"`
+	TSIGSecret    string   `mapstructure:"tsig_secret" json:"tsig_secret,omitempty"`
+	TSIGAlgorithm string   `mapstructure:"tsig_algorithm" json:"tsig_algorithm,omitempty"`
+}
+
 type DingTalkConfig struct {
 	AccessToken string `mapstructure:"access_token" json:"access_token"`
 	Secret      string `mapstructure:"secret" json:"secret"`
@@ -51,9 +102,15 @@ type TelegramConfig struct {
 type MonitorConfig struct {
 	ID                   string   `mapstructure:"id" json:"id"`
 	Name                 string   `mapstructure:"name" json:"name"`
+	ProviderID           string   `mapstructure:"provider_id" json:"provider_id"` // DNSProviderConfig.ID; empty uses the active Cloudflare account
+	AccountID            string   `mapstructure:"account_id" json:"account_id"`   // CloudflareAccount.ID to use instead of the active account (no provider_id only)
 	ZoneID               string   `mapstructure:"zone_id" json:"zone_id"`
+	RecordLine           string   `mapstructure:"record_line" json:"record_line"`             // alidns/dnspod: only switch records on this ISP line
+	RecordType           string   `mapstructure:"record_type" json:"record_type"`             // record type to switch; empty: A/AAAA by IP family, CNAME for host names
+	RecordID             string   `mapstructure:"record_id" json:"record_id"`                 // only switch this record (single-subdomain monitors)
+	CreateIfMissing      bool     `mapstructure:"create_if_missing" json:"create_if_missing"` // create the record on switch when none exists
 	Subdomains           []string `mapstructure:"subdomains" json:"subdomains"`
-	CheckType            string   `mapstructure:"check_type" json:"check_type"`     // ping, http, https
+	CheckType            string   `mapstructure:"check_type" json:"check_type"`     // ping, http, https, tcping, push
 	CheckTarget          string   `mapstructure:"check_target" json:"check_target"` // IP or URL
 	OriginalIP           string   `mapstructure:"original_ip" json:"original_ip"`
 	BackupIP             string   `mapstructure:"backup_ip" json:"backup_ip"`
@@ -65,11 +122,52 @@ type MonitorConfig struct {
 	OriginalIPCDNEnabled bool     `mapstructure:"original_ip_cdn_enabled" json:"original_ip_cdn_enabled"`
 	BackupIPCDNEnabled   bool     `mapstructure:"backup_ip_cdn_enabled" json:"backup_ip_cdn_enabled"`
 
+	// Action selects what a switch changes: "dns" (default) rewrites the subdomains' records, "lb_pool"
+	// flips the original and backup origins of a Cloudflare Load Balancing pool instead. Origins are
+	// matched by name or address; empty LBOriginalOrigin/LBBackupOrigin fall back to OriginalIP/BackupIP.
+	// LBMode "enable" (default) toggles the origins' enabled flag, "weight" sets their weights to 1 and 0.
+	Action           string `mapstructure:"action" json:"action"`
+	LBAccountID      string `mapstructure:"lb_account_id" json:"lb_account_id"`
+	LBPoolID         string `mapstructure:"lb_pool_id" json:"lb_pool_id"`
+	LBOriginalOrigin string `mapstructure:"lb_original_origin" json:"lb_original_origin"`
+	LBBackupOrigin   string `mapstructure:"lb_backup_origin" json:"lb_backup_origin"`
+	LBMode           string `mapstructure:"lb_mode" json:"lb_mode"`
+
 	// Schedule switch (hours). When enabled, periodically updates DNS to the target IP.
 	// If ScheduleSwitchIP is empty, it toggles between OriginalIP and BackupIP.
 	ScheduleEnabled  bool   `mapstructure:"schedule_enabled" json:"schedule_enabled"`
 	ScheduleHours    int    `mapstructure:"schedule_hours" json:"schedule_hours"`
 	ScheduleSwitchIP string `mapstructure:"schedule_switch_ip" json:"schedule_switch_ip"`
+
+	// ParentIDs lists upstream monitors this one depends on. While a parent is down, this monitor is
+	// marked unreachable and its own failover and notifications are suppressed.
+	ParentIDs []string `mapstructure:"parent_ids" json:"parent_ids"`
+
+	// Push (heartbeat) monitors: the origin calls POST /api/heartbeat/:token. The monitor fails a check
+	// when no heartbeat arrived within Interval + PushGraceSeconds.
+	PushToken        string `mapstructure:"push_token" json:"push_token"`
+	PushGraceSeconds int    `mapstructure:"push_grace_seconds" json:"push_grace_seconds"`
+
+	// RestorePolicy controls failback: "auto" (default) restores after SuccessThreshold checks, "manual"
+	// only notifies and waits for POST /restore, "auto-after-approval" restores once approved via API.
+	RestorePolicy string `mapstructure:"restore_policy" json:"restore_policy"`
+
+	// MinHoldSeconds keeps a failed-over monitor on backup for at least this long. The original must then
+	// stay healthy for StabilizationSeconds, with at most StabilizationMaxFailures failed checks, before
+	// restoring. Zero disables either rule.
+	MinHoldSeconds           int `mapstructure:"min_hold_seconds" json:"min_hold_seconds"`
+	StabilizationSeconds     int `mapstructure:"stabilization_seconds" json:"stabilization_seconds"`
+	StabilizationMaxFailures int `mapstructure:"stabilization_max_failures" json:"stabilization_max_failures"`
+
+	// SuspectInterval (seconds) replaces Interval after the first failed check until the monitor recovers.
+	// Retries re-probes a failed check within the same cycle, RetryDelaySeconds apart.
+	SuspectInterval   int `mapstructure:"suspect_interval" json:"suspect_interval"`
+	Retries           int `mapstructure:"retries" json:"retries"`
+	RetryDelaySeconds int `mapstructure:"retry_delay_seconds" json:"retry_delay_seconds"`
+
+	// Revision is set by the store on every save. DNS updates queued for an older revision are dropped,
+	// since they were decided on a config that no longer applies.
+	Revision int64 `mapstructure:"-" json:"revision"`
 }
 
 type ServerConfig struct {
@@ -77,6 +175,148 @@ type ServerConfig struct {
 	Auth string `mapstructure:"auth" json:"auth"`
 }
 
+// AgentConfig describes a remote probe agent allowed to report results to this server.
+type AgentConfig struct {
+	ID       string `mapstructure:"id" json:"id"`
+	Name     string `mapstructure:"name" json:"name"`
+	Location string `mapstructure:"location" json:"location"`
+	Token    string `mapstructure:"token" json:"token"`
+}
+
+// QuorumConfig controls how agent results are combined before a target is declared down.
+type QuorumConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// MinLocations is the number of distinct locations that must see the target as down (default 2).
+	MinLocations int `mapstructure:"min_locations" json:"min_locations"`
+	// IncludeLocal lets the server's own probe vote as the "local" location.
+	IncludeLocal bool `mapstructure:"include_local" json:"include_local"`
+}
+
+// CanaryConfig lists well-known targets used to tell a local network outage from a real origin failure.
+// When every canary fails, failovers are suspended until at least one recovers.
+type CanaryConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// Targets may be an IP/host (ping), host:port (tcping) or an http(s) URL.
+	Targets        []string `mapstructure:"targets" json:"targets"`
+	Interval       int      `mapstructure:"interval" json:"interval"`
+	TimeoutSeconds int      `mapstructure:"timeout_seconds" json:"timeout_seconds"`
+}
+
+// CircuitBreakerConfig caps how many monitors may fail over within a window.
+// Failovers beyond the limit are held until confirmed via API.
+type CircuitBreakerConfig struct {
+	Enabled       bool `mapstructure:"enabled" json:"enabled"`
+	MaxSwitches   int  `mapstructure:"max_switches" json:"max_switches"`
+	WindowMinutes int  `mapstructure:"window_minutes" json:"window_minutes"`
+}
+
+// InboundWebhookConfig configures the endpoint that lets Alertmanager, Grafana or any JSON sender
+// trigger failovers. Alerts are mapped to monitors by MatchLabel (ID or name).
+type InboundWebhookConfig struct {
+	Enabled bool   `mapstructure:"enabled" json:"enabled"`
+	Token   string `mapstructure:"token" json:"token"`
+	// MatchLabel is the alert label holding the monitor ID or name (default "cfguard_monitor").
+	MatchLabel string `mapstructure:"match_label" json:"match_label"`
+	// RestoreOnResolved switches back to the original IP when the alert resolves, as far as the monitor's
+	// restore policy and restore windows allow. Otherwise a resolved alert only hands the monitor back to
+	// its own checks.
+	RestoreOnResolved bool `mapstructure:"restore_on_resolved" json:"restore_on_resolved"`
+}
+
+// SchedulerConfig sizes the check worker pool. Changes take effect after a restart.
+type SchedulerConfig struct {
+	// Workers is the number of concurrent checks (default 32).
+	Workers int `mapstructure:"workers" json:"workers"`
+	// TypeLimits caps concurrent checks per check type, e.g. {"ping": 8}.
+	TypeLimits map[string]int `mapstructure:"type_limits" json:"type_limits"`
+	// DedupWindowSeconds is how long an identical probe result (same type, target and parameters) is
+	// reused by other monitors. 0 uses the default of 10 seconds, a negative value only joins probes
+	// that are still in flight.
+	DedupWindowSeconds int `mapstructure:"dedup_window_seconds" json:"dedup_window_seconds"`
+}
+
+// DNSServerConfig runs the built-in authoritative DNS server, which answers for the zones of "builtin"
+// DNS providers straight from the engine's state. Changes take effect after a restart.
+type DNSServerConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// Listen is the UDP and TCP address to serve on (default ":53").
+	Listen string `mapstructure:"listen" json:"listen"`
+	// TTL of answers in seconds (default 30); kept low so resolvers pick up a switch quickly.
+	TTL int `mapstructure:"ttl" json:"ttl"`
+	// Nameservers are the NS host names the zones are delegated to; the first one is the SOA MNAME.
+	Nameservers []string `mapstructure:"nameservers" json:"nameservers"`
+	// Hostmaster is the SOA contact mailbox (default hostmaster.<zone>).
+	Hostmaster string `mapstructure:"hostmaster" json:"hostmaster"`
+}
+
+// DNSRetryConfig tunes how DNS updates that failed during a switch are retried.
+type DNSRetryConfig struct {
+	// MaxBackoffSeconds caps the exponential backoff between attempts (default 300). A provider's
+	// Retry-After still wins when it asks for longer.
+	MaxBackoffSeconds int `mapstructure:"max_backoff_seconds" json:"max_backoff_seconds"`
+	// AlertAfterSeconds sends an alert once an update has been pending this long (default 300).
+	AlertAfterSeconds int `mapstructure:"alert_after_seconds" json:"alert_after_seconds"`
+}
+
+// DriftConfig controls the reconciler that periodically compares each monitored subdomain's live
+// records with the IP and proxied flag the engine expects, catching edits made outside the engine.
+type DriftConfig struct {
+	Enabled         bool `mapstructure:"enabled" json:"enabled"`
+	IntervalSeconds int  `mapstructure:"interval_seconds" json:"interval_seconds"` // default 300
+	// AutoCorrect re-applies the expected IP (through the outbox) when drift is found.
+	AutoCorrect bool `mapstructure:"auto_correct" json:"auto_correct"`
+}
+
+// PropagationConfig controls the check that follows every applied switch: each switched record is
+// looked up on Resolvers until all of them answer with the new target, and an alert is sent when that
+// does not happen within TimeoutSeconds. Proxied Cloudflare records, whose public answers are
+// Cloudflare's own addresses, are checked through the Cloudflare API instead.
+type PropagationConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// Resolvers are "ip" or "ip:port" (default 1.1.1.1, 8.8.8.8 and 9.9.9.9).
+	Resolvers       []string `mapstructure:"resolvers" json:"resolvers"`
+	TimeoutSeconds  int      `mapstructure:"timeout_seconds" json:"timeout_seconds"`   // default 300
+	IntervalSeconds int      `mapstructure:"interval_seconds" json:"interval_seconds"` // default 10
+}
+
+// OutboxEntry is a switch whose DNS update has not been applied yet. Entries are persisted, so retries
+// survive restarts; each monitor has at most one, as only its latest target matters.
+type OutboxEntry struct {
+	ID          string `json:"id"`
+	MonitorID   string `json:"monitor_id"`
+	Name        string `json:"name"`
+	IP          string `json:"ip"`
+	Proxied     bool   `json:"proxied"`
+	Reason      string `json:"reason"`
+	Revision    int64  `json:"revision"`     // MonitorConfig.Revision the update was decided on
+	CreatedAt   int64  `json:"created_at"`   // unix ms
+	NextAttempt int64  `json:"next_attempt"` // unix ms
+	Attempts    int    `json:"attempts"`
+	LastError   string `json:"last_error,omitempty"`
+	Alerted     bool   `json:"alerted,omitempty"`
+}
+
+// MonitorState is the switching state of a monitor, persisted on every transition so that a restart
+// resumes a failover instead of assuming every monitor is back on its original IP.
+type MonitorState struct {
+	Status          string `json:"status"`
+	CurrentIP       string `json:"current_ip"`
+	SwitchedAt      int64  `json:"switched_at,omitempty"` // unix ms
+	ExternalHold    bool   `json:"external_hold,omitempty"`
+	RestoreApproved bool   `json:"restore_approved,omitempty"`
+	// HeldAt and HeldReason describe a failover held by the circuit breaker (status "Held").
+	HeldAt     int64  `json:"held_at,omitempty"` // unix ms
+	HeldReason string `json:"held_reason,omitempty"`
+}
+
+// AppliedTarget is the last switch a provider accepted for a monitor, i.e. what its records should hold.
+type AppliedTarget struct {
+	IP        string `json:"ip"`
+	Proxied   bool   `json:"proxied"`
+	Revision  int64  `json:"revision"`   // MonitorConfig.Revision the switch was applied with
+	AppliedAt int64  `json:"applied_at"` // unix ms
+}
+
 type SwitchEvent struct {
 	Timestamp int64  `json:"timestamp"`
 	MonitorID string `json:"monitor_id"`
@@ -85,7 +325,15 @@ type SwitchEvent struct {
 	ToIP      string `json:"to_ip"`
 	ToBackup  bool   `json:"to_backup"`
 	CheckType string `json:"check_type"`
-	Reason    string `json:"reason,omitempty"` // failover, restore, schedule
+	Reason    string `json:"reason,omitempty"` // failover, restore, schedule, external
+	// Dependents are the child monitors affected by this switch (see MonitorConfig.ParentIDs).
+	Dependents []string `json:"dependents,omitempty"`
+	// Propagation is "verified" or "timeout" once the propagation check finished (see
+	// PropagationConfig); PropagationMs is how long after the DNS update that took.
+	Propagation   string `json:"propagation,omitempty"`
+	PropagationMs int64  `json:"propagation_ms,omitempty"`
+	// ApplyError is set when applying the switch right away failed; the update stays queued and is retried.
+	ApplyError string `json:"apply_error,omitempty"`
 }
 
 type IPDownEvent struct {
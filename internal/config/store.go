@@ -1,8 +1,12 @@
 package config
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"log"
 	"os"
+	"slices"
 	"sync"
 )
 
@@ -10,6 +14,14 @@ type Store struct {
 	path string
 	mu   sync.RWMutex
 	data Config
+	// providersGen counts changes to the DNS providers, so readers can cache what they derive from them.
+	providersGen uint64
+
+	// Monitor states not yet merged into data, written by RunStateFlusher or the next save. They are kept
+	// apart from mu so the engine can hand over a state without waiting for a data file write.
+	stateMu       sync.Mutex
+	pendingStates map[string]MonitorState
+	stateDirty    chan struct{}
 }
 
 func NewStore(path string) *Store {
@@ -20,6 +32,8 @@ func NewStore(path string) *Store {
 			History:  make([]SwitchEvent, 0),
 			IPDown:   make([]IPDownEvent, 0),
 		},
+		pendingStates: make(map[string]MonitorState),
+		stateDirty:    make(chan struct{}, 1),
 	}
 }
 
@@ -40,16 +54,9 @@ func (s *Store) Load() error {
 }
 
 func (s *Store) Save() error {
-	s.mu.RLock()
-	snapshot := cloneConfig(s.data)
-	s.mu.RUnlock()
-
-	file, err := json.MarshalIndent(snapshot, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(s.path, file, 0644)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveLocked()
 }
 
 func (s *Store) GetSnapshot() Config {
@@ -79,28 +86,138 @@ func (s *Store) GetMonitor(id string) (MonitorConfig, bool) {
 	return MonitorConfig{}, false
 }
 
-func (s *Store) UpsertMonitor(m MonitorConfig) error {
+// UpsertMonitor saves m and sets m.Revision to its new revision.
+func (s *Store) UpsertMonitor(m *MonitorConfig) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	for i, item := range s.data.Monitors {
 		if item.ID == m.ID {
-			s.data.Monitors[i] = m
+			m.Revision = item.Revision + 1
+			s.data.Monitors[i] = *m
 			return s.saveLocked()
 		}
 	}
-	s.data.Monitors = append(s.data.Monitors, m)
+	m.Revision = 1
+	s.data.Monitors = append(s.data.Monitors, *m)
 	return s.saveLocked()
 }
 
-func (s *Store) DeleteMonitor(id string) error {
+// DeleteMonitor removes a monitor and strips it from the ParentIDs of its dependents, which are
+// returned so callers can restart them with the updated config.
+func (s *Store) DeleteMonitor(id string) ([]MonitorConfig, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	for i, item := range s.data.Monitors {
-		if item.ID == id {
-			s.data.Monitors = append(s.data.Monitors[:i], s.data.Monitors[i+1:]...)
-			return s.saveLocked()
+	s.data.Monitors = slices.DeleteFunc(s.data.Monitors, func(m MonitorConfig) bool { return m.ID == id })
+	delete(s.data.States, id)
+	delete(s.data.Applied, id)
+	s.stateMu.Lock()
+	delete(s.pendingStates, id)
+	s.stateMu.Unlock()
+
+	var dependents []MonitorConfig
+	for i := range s.data.Monitors {
+		m := &s.data.Monitors[i]
+		if !slices.Contains(m.ParentIDs, id) {
+			continue
+		}
+		m.ParentIDs = slices.DeleteFunc(slices.Clone(m.ParentIDs), func(pid string) bool { return pid == id })
+		dependents = append(dependents, cloneMonitorConfig(*m))
+	}
+	return dependents, s.saveLocked()
+}
+
+func (s *Store) GetMonitorState(id string) (MonitorState, bool) {
+	s.stateMu.Lock()
+	st, ok := s.pendingStates[id]
+	s.stateMu.Unlock()
+	if ok {
+		return st, true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, ok = s.data.States[id]
+	return st, ok
+}
+
+// PutMonitorState saves the state of a monitor. It only queues the state, so it never waits for the data
+// file; RunStateFlusher writes queued states shortly after, coalescing bursts into a single write.
+// States of monitors that have been deleted are dropped when they are written.
+func (s *Store) PutMonitorState(id string, st MonitorState) error {
+	s.stateMu.Lock()
+	s.pendingStates[id] = st
+	s.stateMu.Unlock()
+
+	select {
+	case s.stateDirty <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// RunStateFlusher writes the states queued by PutMonitorState until ctx is done. States still queued
+// then are written by the next Save.
+func (s *Store) RunStateFlusher(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stateDirty:
 		}
+
+		s.mu.Lock()
+		var err error
+		if s.mergeStatesLocked() {
+			err = s.saveLocked()
+		}
+		s.mu.Unlock()
+		if err != nil {
+			log.Printf("Failed to save monitor states: %v", err)
+		}
+	}
+}
+
+// mergeStatesLocked moves the queued monitor states into data, reporting whether there were any.
+// Callers hold mu.
+func (s *Store) mergeStatesLocked() bool {
+	s.stateMu.Lock()
+	pending := s.pendingStates
+	if len(pending) == 0 {
+		s.stateMu.Unlock()
+		return false
+	}
+	s.pendingStates = make(map[string]MonitorState)
+	s.stateMu.Unlock()
+
+	if s.data.States == nil {
+		s.data.States = make(map[string]MonitorState)
 	}
+	for id, st := range pending {
+		if slices.ContainsFunc(s.data.Monitors, func(m MonitorConfig) bool { return m.ID == id }) {
+			s.data.States[id] = st
+		}
+	}
+	return true
+}
+
+func (s *Store) GetAppliedTarget(id string) (AppliedTarget, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.data.Applied[id]
+	return t, ok
+}
+
+// PutAppliedTarget records what a monitor's records were switched to. Deleted monitors are ignored.
+func (s *Store) PutAppliedTarget(id string, t AppliedTarget) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !slices.ContainsFunc(s.data.Monitors, func(m MonitorConfig) bool { return m.ID == id }) {
+		return nil
+	}
+	if s.data.Applied == nil {
+		s.data.Applied = make(map[string]AppliedTarget)
+	}
+	s.data.Applied[id] = t
 	return s.saveLocked()
 }
 
@@ -122,6 +239,45 @@ func (s *Store) GetCloudflareConfig() CloudflareConfig {
 	return s.data.Cloudflare
 }
 
+// BindUnboundMonitors binds Cloudflare monitors without an account (created before account binding
+// existed) to the active account, so activating another account later does not move them. The
+// effective account does not change, so Revision is kept. It returns the monitors it bound.
+func (s *Store) BindUnboundMonitors() ([]MonitorConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.ActiveAccountIndex < 0 || s.data.ActiveAccountIndex >= len(s.data.CloudflareAccounts) {
+		return nil, nil
+	}
+	accountID := s.data.CloudflareAccounts[s.data.ActiveAccountIndex].ID
+	if accountID == "" {
+		return nil, nil
+	}
+	var bound []MonitorConfig
+	for i := range s.data.Monitors {
+		if m := &s.data.Monitors[i]; m.ProviderID == "" && m.AccountID == "" {
+			m.AccountID = accountID
+			bound = append(bound, cloneMonitorConfig(*m))
+		}
+	}
+	if len(bound) == 0 {
+		return nil, nil
+	}
+	return bound, s.saveLocked()
+}
+
+// GetCloudflareAccountConfig returns the credentials of the account with the given ID, regardless of
+// which account is active.
+func (s *Store) GetCloudflareAccountConfig(id string) (CloudflareConfig, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, account := range s.data.CloudflareAccounts {
+		if account.ID == id {
+			return CloudflareConfig{APIToken: account.APIToken, APIKey: account.APIKey, Email: account.Email}, true
+		}
+	}
+	return CloudflareConfig{}, false
+}
+
 func (s *Store) ListCloudflareAccounts() []CloudflareAccount {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -130,6 +286,16 @@ func (s *Store) ListCloudflareAccounts() []CloudflareAccount {
 	return out
 }
 
+// ActiveCloudflareAccountID returns the ID of the active Cloudflare account, or "" when no account is configured.
+func (s *Store) ActiveCloudflareAccountID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.data.ActiveAccountIndex < 0 || s.data.ActiveAccountIndex >= len(s.data.CloudflareAccounts) {
+		return ""
+	}
+	return s.data.CloudflareAccounts[s.data.ActiveAccountIndex].ID
+}
+
 func (s *Store) GetActiveAccountIndex() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -207,6 +373,297 @@ func (s *Store) ActivateCloudflareAccount(id string) error {
 	return s.saveLocked()
 }
 
+func (s *Store) ListDNSProviders() []DNSProviderConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]DNSProviderConfig, len(s.data.DNSProviders))
+	copy(out, s.data.DNSProviders)
+	return out
+}
+
+// DNSProvidersGeneration changes whenever a DNS provider is added, updated or deleted.
+func (s *Store) DNSProvidersGeneration() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.providersGen
+}
+
+func (s *Store) GetDNSProvider(id string) (DNSProviderConfig, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, p := range s.data.DNSProviders {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return DNSProviderConfig{}, false
+}
+
+func (s *Store) UpsertDNSProvider(p DNSProviderConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.providersGen++
+	for i, item := range s.data.DNSProviders {
+		if item.ID == p.ID {
+			s.data.DNSProviders[i] = p
+			return s.saveLocked()
+		}
+	}
+	s.data.DNSProviders = append(s.data.DNSProviders, p)
+	return s.saveLocked()
+}
+
+func (s *Store) DeleteDNSProvider(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.providersGen++
+	for i, item := range s.data.DNSProviders {
+		if item.ID == id {
+			s.data.DNSProviders = append(s.data.DNSProviders[:i], s.data.DNSProviders[i+1:]...)
+			return s.saveLocked()
+		}
+	}
+	return s.saveLocked()
+}
+
+func (s *Store) ListAgents() []AgentConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]AgentConfig, len(s.data.Agents))
+	copy(out, s.data.Agents)
+	return out
+}
+
+// GetAgentByToken finds the agent that owns the given token. Every agent's token is compared in constant
+// time, so the response time reveals neither the token nor which agent it came close to.
+func (s *Store) GetAgentByToken(token string) (AgentConfig, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if token == "" {
+		return AgentConfig{}, false
+	}
+	var found AgentConfig
+	ok := false
+	for _, a := range s.data.Agents {
+		if subtle.ConstantTimeCompare([]byte(a.Token), []byte(token)) == 1 {
+			found, ok = a, true
+		}
+	}
+	return found, ok
+}
+
+func (s *Store) UpsertAgent(agent AgentConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, item := range s.data.Agents {
+		if item.ID == agent.ID {
+			s.data.Agents[i] = agent
+			return s.saveLocked()
+		}
+	}
+	s.data.Agents = append(s.data.Agents, agent)
+	return s.saveLocked()
+}
+
+func (s *Store) DeleteAgent(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, item := range s.data.Agents {
+		if item.ID == id {
+			s.data.Agents = append(s.data.Agents[:i], s.data.Agents[i+1:]...)
+			return s.saveLocked()
+		}
+	}
+	return s.saveLocked()
+}
+
+func (s *Store) GetQuorumConfig() QuorumConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.Quorum
+}
+
+func (s *Store) UpdateQuorumConfig(q QuorumConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Quorum = q
+	return s.saveLocked()
+}
+
+func (s *Store) GetCanaryConfig() CanaryConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := s.data.Canary
+	out.Targets = append([]string(nil), s.data.Canary.Targets...)
+	return out
+}
+
+func (s *Store) UpdateCanaryConfig(c CanaryConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Canary = c
+	return s.saveLocked()
+}
+
+func (s *Store) GetCircuitBreakerConfig() CircuitBreakerConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.CircuitBreaker
+}
+
+func (s *Store) UpdateCircuitBreakerConfig(c CircuitBreakerConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.CircuitBreaker = c
+	return s.saveLocked()
+}
+
+func (s *Store) GetInboundWebhookConfig() InboundWebhookConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.InboundWebhook
+}
+
+func (s *Store) UpdateInboundWebhookConfig(c InboundWebhookConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.InboundWebhook = c
+	return s.saveLocked()
+}
+
+func (s *Store) GetDNSServerConfig() DNSServerConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := s.data.DNSServer
+	out.Nameservers = append([]string(nil), s.data.DNSServer.Nameservers...)
+	return out
+}
+
+func (s *Store) GetSchedulerConfig() SchedulerConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := s.data.Scheduler
+	out.TypeLimits = make(map[string]int, len(s.data.Scheduler.TypeLimits))
+	for k, v := range s.data.Scheduler.TypeLimits {
+		out.TypeLimits[k] = v
+	}
+	return out
+}
+
+func (s *Store) GetDNSRetryConfig() DNSRetryConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.DNSRetry
+}
+
+func (s *Store) UpdateDNSRetryConfig(c DNSRetryConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.DNSRetry = c
+	return s.saveLocked()
+}
+
+func (s *Store) GetDriftConfig() DriftConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.Drift
+}
+
+func (s *Store) UpdateDriftConfig(c DriftConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Drift = c
+	return s.saveLocked()
+}
+
+func (s *Store) GetPropagationConfig() PropagationConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := s.data.Propagation
+	out.Resolvers = append([]string(nil), s.data.Propagation.Resolvers...)
+	return out
+}
+
+func (s *Store) UpdatePropagationConfig(c PropagationConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Propagation = c
+	return s.saveLocked()
+}
+
+func (s *Store) ListOutbox() []OutboxEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]OutboxEntry, len(s.data.Outbox))
+	copy(out, s.data.Outbox)
+	return out
+}
+
+// GetOutboxEntry returns the pending update of a monitor.
+func (s *Store) GetOutboxEntry(monitorID string) (OutboxEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, e := range s.data.Outbox {
+		if e.MonitorID == monitorID {
+			return e, true
+		}
+	}
+	return OutboxEntry{}, false
+}
+
+// PutOutboxEntry queues e, replacing any update still pending for the same monitor.
+func (s *Store) PutOutboxEntry(e OutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, item := range s.data.Outbox {
+		if item.MonitorID == e.MonitorID {
+			s.data.Outbox[i] = e
+			return s.saveLocked()
+		}
+	}
+	s.data.Outbox = append(s.data.Outbox, e)
+	return s.saveLocked()
+}
+
+// AddOutboxEntry queues e only if nothing is pending for its monitor yet, and reports whether it did.
+func (s *Store) AddOutboxEntry(e OutboxEntry) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range s.data.Outbox {
+		if item.MonitorID == e.MonitorID {
+			return false, nil
+		}
+	}
+	s.data.Outbox = append(s.data.Outbox, e)
+	return true, s.saveLocked()
+}
+
+// UpdateOutboxEntry stores the retry state of e. It reports false when e is no longer queued, because
+// it was applied, discarded or replaced by a newer update.
+func (s *Store) UpdateOutboxEntry(e OutboxEntry) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, item := range s.data.Outbox {
+		if item.ID == e.ID {
+			s.data.Outbox[i] = e
+			return true, s.saveLocked()
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) DeleteOutboxEntry(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, item := range s.data.Outbox {
+		if item.ID == id {
+			s.data.Outbox = append(s.data.Outbox[:i], s.data.Outbox[i+1:]...)
+			return s.saveLocked()
+		}
+	}
+	return nil
+}
+
 func (s *Store) GetDingTalkConfig() DingTalkConfig {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -246,6 +703,46 @@ func (s *Store) AppendSwitchEvent(evt SwitchEvent, max int) error {
 	return s.saveLocked()
 }
 
+// SetSwitchPropagation records the propagation result on the monitor's latest switch event, provided
+// that event switched to ip and has no result yet. It reports whether an event was updated.
+func (s *Store) SetSwitchPropagation(monitorID, ip, result string, ms int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.data.History) - 1; i >= 0; i-- {
+		evt := &s.data.History[i]
+		if evt.MonitorID != monitorID {
+			continue
+		}
+		if evt.ToIP != ip || evt.Propagation != "" {
+			return false, nil
+		}
+		evt.Propagation = result
+		evt.PropagationMs = ms
+		return true, s.saveLocked()
+	}
+	return false, nil
+}
+
+// SetSwitchApplyError records err on the monitor's latest switch event, provided that event switched to ip.
+func (s *Store) SetSwitchApplyError(monitorID, ip, err string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.data.History) - 1; i >= 0; i-- {
+		evt := &s.data.History[i]
+		if evt.MonitorID != monitorID {
+			continue
+		}
+		if evt.ToIP != ip {
+			return nil
+		}
+		evt.ApplyError = err
+		return s.saveLocked()
+	}
+	return nil
+}
+
 func (s *Store) AppendIPDownEvent(evt IPDownEvent, max int) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -287,12 +784,19 @@ func (s *Store) ListIPDownEvents(limit int) []IPDownEvent {
 	return out
 }
 
+// saveLocked writes the data file. It is the only writer and callers hold s.mu, so saves never interleave.
 func (s *Store) saveLocked() error {
+	s.mergeStatesLocked()
 	file, err := json.MarshalIndent(s.data, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(s.path, file, 0644)
+	// Write to a temp file and rename, so an interrupted save never leaves a truncated data file.
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, file, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
 }
 
 func cloneConfig(in Config) Config {
@@ -309,6 +813,31 @@ func cloneConfig(in Config) Config {
 	out.IPDown = make([]IPDownEvent, len(in.IPDown))
 	copy(out.IPDown, in.IPDown)
 
+	out.Outbox = make([]OutboxEntry, len(in.Outbox))
+	copy(out.Outbox, in.Outbox)
+
+	out.States = make(map[string]MonitorState, len(in.States))
+	for id, st := range in.States {
+		out.States[id] = st
+	}
+	out.Applied = make(map[string]AppliedTarget, len(in.Applied))
+	for id, t := range in.Applied {
+		out.Applied[id] = t
+	}
+
+	out.DNSProviders = make([]DNSProviderConfig, 0, len(in.DNSProviders))
+	for _, p := range in.DNSProviders {
+		p.Zones = append([]string(nil), p.Zones...)
+		out.DNSProviders = append(out.DNSProviders, p)
+	}
+
+	out.Agents = make([]AgentConfig, len(in.Agents))
+	copy(out.Agents, in.Agents)
+
+	out.Canary.Targets = append([]string(nil), in.Canary.Targets...)
+	out.DNSServer.Nameservers = append([]string(nil), in.DNSServer.Nameservers...)
+	out.Propagation.Resolvers = append([]string(nil), in.Propagation.Resolvers...)
+
 	return out
 }
 
@@ -316,5 +845,6 @@ func cloneMonitorConfig(in MonitorConfig) MonitorConfig {
 	out := in
 	out.Subdomains = make([]string, len(in.Subdomains))
 	copy(out.Subdomains, in.Subdomains)
+	out.ParentIDs = append([]string(nil), in.ParentIDs...)
 	return out
 }
@@ -0,0 +1,300 @@
+// Package dnsserver is an embedded authoritative DNS server. It answers for the zones of "builtin" DNS
+// providers straight from the failover engine's state, so a switch takes effect on the next query.
+package dnsserver
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"dns-failover/internal/config"
+	"dns-failover/internal/monitor"
+	"dns-failover/internal/service"
+
+	"github.com/miekg/dns"
+)
+
+type Server struct {
+	engine  *monitor.Engine
+	store   *config.Store
+	cfg     config.DNSServerConfig
+	servers []*dns.Server
+
+	mu    sync.Mutex
+	index *zoneIndex
+}
+
+// zoneIndex maps every builtin zone (lower-case FQDN) to the IDs of the monitors serving it. It is rebuilt
+// when the DNS providers or the running monitors change, not on every query.
+type zoneIndex struct {
+	providersGen uint64
+	monitorsGen  uint64
+	monitors     map[string][]string
+}
+
+func New(engine *monitor.Engine, store *config.Store, cfg config.DNSServerConfig) *Server {
+	if cfg.Listen == "" {
+		cfg.Listen = ":53"
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 30
+	}
+	return &Server{engine: engine, store: store, cfg: cfg}
+}
+
+// Start listens on UDP and TCP. It returns once both listeners are bound; a listener that fails later is
+// logged.
+func (s *Server) Start() error {
+	for _, network := range []string{"udp", "tcp"} {
+		ready := make(chan struct{})
+		failed := make(chan error, 1)
+		srv := &dns.Server{
+			Addr:              s.cfg.Listen,
+			Net:               network,
+			Handler:           s,
+			NotifyStartedFunc: func() { close(ready) },
+		}
+		go func() {
+			err := srv.ListenAndServe()
+			select {
+			case <-ready:
+				if err != nil {
+					log.Printf("DNS server (%s) stopped: %v", network, err)
+				}
+			default:
+				failed <- err
+			}
+		}()
+		select {
+		case <-ready:
+		case err := <-failed:
+			s.Shutdown(context.Background())
+			return err
+		}
+		s.servers = append(s.servers, srv)
+	}
+	log.Printf("Built-in DNS server listening on %s", s.cfg.Listen)
+	return nil
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	var firstErr error
+	for _, srv := range s.servers {
+		if err := srv.ShutdownContext(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.servers = nil
+	return firstErr
+}
+
+func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	defer w.WriteMsg(m)
+
+	if r.Opcode != dns.OpcodeQuery || len(r.Question) != 1 {
+		m.Rcode = dns.RcodeNotImplemented
+		return
+	}
+	q := r.Question[0]
+	name := strings.ToLower(q.Name)
+
+	zone, monitors := s.lookupZone(name)
+	if zone == "" {
+		m.Rcode = dns.RcodeRefused
+		return
+	}
+	m.Authoritative = true
+
+	if name == zone {
+		switch q.Qtype {
+		case dns.TypeSOA:
+			m.Answer = append(m.Answer, s.soa(zone))
+		case dns.TypeNS:
+			m.Answer = append(m.Answer, s.ns(zone)...)
+		}
+	}
+
+	targets := answerTargets(name, zone, monitors)
+	if len(targets) == 0 && name != zone {
+		m.Rcode = dns.RcodeNameError
+		m.Ns = append(m.Ns, s.soa(zone))
+		return
+	}
+	m.Answer = append(m.Answer, s.records(name, q.Qtype, targets)...)
+	if len(m.Answer) == 0 {
+		m.Ns = append(m.Ns, s.soa(zone))
+	}
+}
+
+// lookupZone returns the most specific builtin zone containing name, and the monitors serving it.
+func (s *Server) lookupZone(name string) (string, []monitor.MonitorState) {
+	idx := s.zones()
+	for zone := name; zone != ""; _, zone, _ = strings.Cut(zone, ".") {
+		if ids, ok := idx.monitors[zone]; ok {
+			return zone, s.engine.States(ids)
+		}
+	}
+	return "", nil
+}
+
+// zones returns the zone index, rebuilding it if the providers or monitors changed since it was built.
+func (s *Server) zones() *zoneIndex {
+	providersGen, monitorsGen := s.store.DNSProvidersGeneration(), s.engine.MonitorsGeneration()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index != nil && s.index.providersGen == providersGen && s.index.monitorsGen == monitorsGen {
+		return s.index
+	}
+
+	providers := make(map[string]map[string]bool)
+	for _, p := range s.store.ListDNSProviders() {
+		if p.Type != service.ProviderBuiltin {
+			continue
+		}
+		for _, z := range p.Zones {
+			z = dns.Fqdn(strings.ToLower(z))
+			if providers[z] == nil {
+				providers[z] = make(map[string]bool)
+			}
+			providers[z][p.ID] = true
+		}
+	}
+	monitors := make(map[string][]string, len(providers))
+	for z := range providers {
+		monitors[z] = nil
+	}
+	for _, st := range s.engine.Snapshot() {
+		z := dns.Fqdn(strings.ToLower(st.Config.ZoneID))
+		if providers[z][st.Config.ProviderID] {
+			monitors[z] = append(monitors[z], st.Config.ID)
+		}
+	}
+	s.index = &zoneIndex{providersGen: providersGen, monitorsGen: monitorsGen, monitors: monitors}
+	return s.index
+}
+
+// answerTargets collects the addresses (or a CNAME target) for name. Every monitor that is not failed
+// over contributes its current IP; only when none is healthy are the failed-over monitors' backups served.
+func answerTargets(name, zone string, monitors []monitor.MonitorState) []string {
+	var healthy, failedOver []string
+	for _, st := range monitors {
+		if !servesName(st.Config, name, zone) || st.CurrentIP == "" {
+			continue
+		}
+		if st.Status == monitor.StatusDown {
+			if !st.BackupDown {
+				failedOver = append(failedOver, st.CurrentIP)
+			}
+			continue
+		}
+		healthy = append(healthy, st.CurrentIP)
+	}
+	if len(healthy) > 0 {
+		return dedupe(healthy)
+	}
+	if len(failedOver) == 0 {
+		// Every backup is down as well; answering with them still beats an empty response.
+		for _, st := range monitors {
+			if servesName(st.Config, name, zone) && st.CurrentIP != "" {
+				failedOver = append(failedOver, st.CurrentIP)
+			}
+		}
+	}
+	return dedupe(failedOver)
+}
+
+func servesName(cfg config.MonitorConfig, name, zone string) bool {
+	for _, sub := range cfg.Subdomains {
+		sub = strings.ToLower(strings.TrimSpace(sub))
+		if sub == "@" {
+			sub = zone
+		} else if !strings.HasSuffix(dns.Fqdn(sub), "."+zone) && dns.Fqdn(sub) != zone {
+			sub = sub + "." + zone // relative host name
+		}
+		if dns.Fqdn(sub) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// records builds the answer for qtype. A target that is not an IP is served as a CNAME, which takes
+// precedence over addresses as a name cannot hold both.
+func (s *Server) records(name string, qtype uint16, targets []string) []dns.RR {
+	hdr := func(t uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: t, Class: dns.ClassINET, Ttl: uint32(s.cfg.TTL)}
+	}
+
+	for _, t := range targets {
+		if net.ParseIP(t) == nil {
+			return []dns.RR{&dns.CNAME{Hdr: hdr(dns.TypeCNAME), Target: dns.Fqdn(t)}}
+		}
+	}
+
+	var out []dns.RR
+	for _, t := range targets {
+		ip := net.ParseIP(t)
+		if v4 := ip.To4(); v4 != nil {
+			if qtype == dns.TypeA || qtype == dns.TypeANY {
+				out = append(out, &dns.A{Hdr: hdr(dns.TypeA), A: v4})
+			}
+		} else if qtype == dns.TypeAAAA || qtype == dns.TypeANY {
+			out = append(out, &dns.AAAA{Hdr: hdr(dns.TypeAAAA), AAAA: ip})
+		}
+	}
+	return out
+}
+
+func (s *Server) soa(zone string) dns.RR {
+	mname := "ns1." + zone
+	if len(s.cfg.Nameservers) > 0 {
+		mname = dns.Fqdn(s.cfg.Nameservers[0])
+	}
+	mbox := "hostmaster." + zone
+	if s.cfg.Hostmaster != "" {
+		mbox = dns.Fqdn(strings.Replace(s.cfg.Hostmaster, "@", ".", 1))
+	}
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: uint32(s.cfg.TTL)},
+		Ns:      mname,
+		Mbox:    mbox,
+		Serial:  uint32(time.Now().Unix()),
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  604800,
+		Minttl:  uint32(s.cfg.TTL),
+	}
+}
+
+func (s *Server) ns(zone string) []dns.RR {
+	names := s.cfg.Nameservers
+	if len(names) == 0 {
+		names = []string{"ns1." + zone}
+	}
+	out := make([]dns.RR, 0, len(names))
+	for _, n := range names {
+		out = append(out, &dns.NS{
+			Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 3600},
+			Ns:  dns.Fqdn(n),
+		})
+	}
+	return out
+}
+
+func dedupe(in []string) []string {
+	seen := make(map[string]bool, len(in))
+	out := in[:0]
+	for _, v := range in {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,272 @@
+// Package drift detects DNS records that no longer match the failover engine's state, e.g. after an
+// edit in the provider's dashboard or through the records API, and optionally corrects them.
+package drift
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dns-failover/internal/config"
+	"dns-failover/internal/monitor"
+	"dns-failover/internal/outbox"
+	"dns-failover/internal/service"
+)
+
+const defaultInterval = 5 * time.Minute
+
+// Report is the outcome of the last comparison for one monitor.
+type Report struct {
+	MonitorID       string        `json:"monitor_id"`
+	Name            string        `json:"name"`
+	CheckedAt       int64         `json:"checked_at"`
+	ExpectedIP      string        `json:"expected_ip"`
+	ExpectedProxied bool          `json:"expected_proxied"`
+	Drifted         []RecordDrift `json:"drifted,omitempty"`
+	Corrected       bool          `json:"corrected,omitempty"`
+	Error           string        `json:"error,omitempty"`
+}
+
+// RecordDrift is a record that differs from the expected state, or a subdomain with no record at all.
+type RecordDrift struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	ID      string `json:"id,omitempty"`
+	Content string `json:"content,omitempty"`
+	Proxied *bool  `json:"proxied,omitempty"`
+	Missing bool   `json:"missing,omitempty"`
+}
+
+func (d RecordDrift) String() string {
+	if d.Missing {
+		return fmt.Sprintf("%s %s 记录不存在", d.Name, d.Type)
+	}
+	s := fmt.Sprintf("%s %s %s", d.Name, d.Type, d.Content)
+	if d.Proxied != nil && *d.Proxied {
+		s += " (proxied)"
+	}
+	return s
+}
+
+type Reconciler struct {
+	engine *monitor.Engine
+	store  *config.Store
+	outbox *outbox.Outbox
+
+	mu      sync.RWMutex
+	reports map[string]Report
+}
+
+func New(engine *monitor.Engine, store *config.Store, dnsOutbox *outbox.Outbox) *Reconciler {
+	return &Reconciler{engine: engine, store: store, outbox: dnsOutbox, reports: make(map[string]Report)}
+}
+
+// Run compares all monitors every interval while drift detection is enabled. The configuration is
+// re-read each round, so it can be changed at runtime.
+func (r *Reconciler) Run(ctx context.Context) {
+	for {
+		interval := service.Seconds(r.store.GetDriftConfig().IntervalSeconds, defaultInterval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		if r.store.GetDriftConfig().Enabled {
+			r.CheckAll(ctx)
+		}
+	}
+}
+
+// CheckAll compares every DNS-switching monitor once.
+func (r *Reconciler) CheckAll(ctx context.Context) {
+	autoCorrect := r.store.GetDriftConfig().AutoCorrect
+	seen := make(map[string]bool)
+	for _, st := range r.engine.Snapshot() {
+		if ctx.Err() != nil {
+			return
+		}
+		seen[st.Config.ID] = true
+		r.check(ctx, st, autoCorrect)
+	}
+
+	r.mu.Lock()
+	for id := range r.reports {
+		if !seen[id] {
+			delete(r.reports, id)
+		}
+	}
+	r.mu.Unlock()
+}
+
+// Reports returns the latest report of every checked monitor, drifted ones first.
+func (r *Reconciler) Reports() []Report {
+	r.mu.RLock()
+	out := make([]Report, 0, len(r.reports))
+	for _, rep := range r.reports {
+		out = append(out, rep)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if (len(out[i].Drifted) > 0) != (len(out[j].Drifted) > 0) {
+			return len(out[i].Drifted) > 0
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+func (r *Reconciler) check(ctx context.Context, st monitor.MonitorState, autoCorrect bool) {
+	m := st.Config
+	if !service.NeedsZone(m) || m.ZoneID == "" || st.CurrentIP == "" || r.pending(m.ID) {
+		return
+	}
+	// A held failover waits for confirmation, so the records are about to change or stay on purpose.
+	if st.Status == monitor.StatusHeld {
+		return
+	}
+	p, err := service.ProviderForMonitor(r.store, m)
+	if err != nil {
+		r.record(Report{MonitorID: m.ID, Name: m.Name, CheckedAt: time.Now().UnixMilli(), Error: err.Error()})
+		return
+	}
+	if _, builtin := p.(*service.BuiltinProvider); builtin {
+		return // answers come straight from the engine and cannot drift
+	}
+
+	expectedIP, proxied, applied := r.expectedTarget(m, st.CurrentIP)
+	rep := Report{
+		MonitorID:       m.ID,
+		Name:            m.Name,
+		ExpectedIP:      expectedIP,
+		ExpectedProxied: proxied,
+	}
+	typ := service.TargetType(expectedIP, m.RecordType)
+	opts := service.SwitchOptions(m, proxied)
+	for _, sub := range m.Subdomains {
+		records, err := p.LookupRecords(ctx, m.ZoneID, sub, typ, m.RecordLine)
+		if err != nil {
+			rep.Error = fmt.Sprintf("%s: %v", sub, err)
+			break
+		}
+		matched := service.MatchRecords(records, typ, m.RecordID)
+		if len(matched) == 0 {
+			rep.Drifted = append(rep.Drifted, RecordDrift{Name: sub, Type: typ, Missing: true})
+			continue
+		}
+		// Drift is what a switch to the expected target would change; other members of a round-robin
+		// set are left alone by switches and are not drift.
+		plan, _ := service.PlanSwitch(matched, expectedIP, opts)
+		for i, rec := range matched {
+			if plan[i].Status == service.RecordUnchanged || plan[i].Status == service.RecordSkipped {
+				continue
+			}
+			rep.Drifted = append(rep.Drifted, RecordDrift{Name: rec.Name, Type: rec.Type, ID: rec.ID, Content: rec.Content, Proxied: rec.Proxied})
+		}
+	}
+	rep.CheckedAt = time.Now().UnixMilli()
+
+	// A switch that happened while the records were read makes the comparison meaningless.
+	if r.pending(m.ID) || r.currentIP(m.ID) != st.CurrentIP {
+		return
+	}
+
+	// Only re-apply a target the outbox applied and the engine still stands behind. Anything else would
+	// be a switch decided here, bypassing the circuit breaker and restore policy.
+	if autoCorrect && applied && expectedIP == st.CurrentIP && rep.Error == "" && correctable(m, rep.Drifted) {
+		queued, err := r.outbox.EnqueueIfIdle(m, rep.ExpectedIP, rep.ExpectedProxied, "drift")
+		if err != nil {
+			log.Printf("Failed to queue drift correction for %s: %v", m.Name, err)
+		}
+		rep.Corrected = queued
+	}
+	r.record(rep)
+}
+
+// record stores rep and notifies when the monitor's drift appears, changes or clears.
+func (r *Reconciler) record(rep Report) {
+	r.mu.Lock()
+	prev, had := r.reports[rep.MonitorID]
+	r.reports[rep.MonitorID] = rep
+	r.mu.Unlock()
+
+	if rep.Error != "" {
+		log.Printf("Drift check for %s failed: %s", rep.Name, rep.Error)
+		return
+	}
+
+	was, now := signature(prev.Drifted), signature(rep.Drifted)
+	switch {
+	case now != "" && now != was:
+		msg := fmt.Sprintf("DNS 漂移：%s 的解析记录与预期不一致（预期 %s）：%s", rep.Name, rep.ExpectedIP, now)
+		if rep.Corrected {
+			msg += "，已自动纠正"
+		}
+		r.notify(msg)
+	case now == "" && was != "" && had:
+		r.notify(fmt.Sprintf("DNS 漂移已消除：%s 的解析记录已与预期 %s 一致", rep.Name, rep.ExpectedIP))
+	}
+}
+
+func (r *Reconciler) notify(msg string) {
+	log.Println(msg)
+	service.NewNotificationService(r.store.GetDingTalkConfig(), r.store.GetEmailConfig(), r.store.GetTelegramConfig()).Notify(msg)
+}
+
+func (r *Reconciler) pending(monitorID string) bool {
+	_, ok := r.store.GetOutboxEntry(monitorID)
+	return ok
+}
+
+// currentIP looks up the engine's live IP for one monitor, without snapshotting all of them.
+func (r *Reconciler) currentIP(monitorID string) string {
+	for _, st := range r.engine.States([]string{monitorID}) {
+		return st.CurrentIP
+	}
+	return ""
+}
+
+// expectedTarget returns what m's records should hold: the last target the outbox applied for the
+// current config, reported as applied. Without one, the engine's current IP is used, which can be
+// compared but is never corrected, since nothing shows the records were ever switched to it.
+func (r *Reconciler) expectedTarget(m config.MonitorConfig, currentIP string) (ip string, proxied, applied bool) {
+	if t, ok := r.store.GetAppliedTarget(m.ID); ok && t.Revision == m.Revision {
+		return t.IP, t.Proxied, true
+	}
+	return currentIP, expectedProxied(m, currentIP), false
+}
+
+// expectedProxied mirrors the proxied flag the engine's switches apply for ip.
+func expectedProxied(m config.MonitorConfig, ip string) bool {
+	switch ip {
+	case m.OriginalIP:
+		return m.OriginalIPCDNEnabled
+	case m.BackupIP:
+		return m.BackupIPCDNEnabled
+	}
+	return false
+}
+
+// correctable reports whether re-applying the switch can fix drifted: a missing record is only
+// recreated by monitors with CreateIfMissing.
+func correctable(m config.MonitorConfig, drifted []RecordDrift) bool {
+	for _, d := range drifted {
+		if !d.Missing || m.CreateIfMissing {
+			return true
+		}
+	}
+	return false
+}
+
+func signature(drifted []RecordDrift) string {
+	parts := make([]string, 0, len(drifted))
+	for _, d := range drifted {
+		parts = append(parts, d.String())
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "；")
+}
@@ -0,0 +1,227 @@
+package monitor
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"dns-failover/internal/config"
+)
+
+// HeldSwitch is a failover the circuit breaker refused to apply automatically.
+type HeldSwitch struct {
+	MonitorID string `json:"monitor_id"`
+	Name      string `json:"name"`
+	ToBackup  bool   `json:"to_backup"`
+	Reason    string `json:"reason"`
+	HeldAt    int64  `json:"held_at"`
+}
+
+type heldSwitch struct {
+	HeldSwitch
+	m *Monitor
+}
+
+// SetCircuitBreaker replaces the circuit breaker limits.
+func (e *Engine) SetCircuitBreaker(cfg config.CircuitBreakerConfig) {
+	e.breakerMu.Lock()
+	defer e.breakerMu.Unlock()
+	e.breaker = cfg
+}
+
+// fireSwitch dispatches OnSwitch for a state transition. Callers hold m.mu.
+func (e *Engine) fireSwitch(m *Monitor, toBackup bool, reason string) {
+	if m.ctx.Err() != nil {
+		log.Printf("Monitor %s: stopped or replaced, dropping %s switch", m.Config.Name, reason)
+		return
+	}
+	if e.OnSwitch != nil {
+		e.goCallback("switch", func() { e.OnSwitch(m.ctx, m, toBackup, reason) })
+	}
+}
+
+// failOver moves m onto its backup IP and fires the switch. When the circuit breaker refuses the failover
+// the monitor is marked StatusHeld instead and keeps its current IP until the switch is confirmed,
+// discarded, or the original recovers. Callers hold m.mu.
+func (e *Engine) failOver(m *Monitor, reason string) {
+	if m.ctx.Err() != nil {
+		log.Printf("Monitor %s: stopped or replaced, dropping %s switch", m.Config.Name, reason)
+		return
+	}
+	if !e.allowFailover(m, reason) {
+		log.Printf("Monitor %s: circuit breaker open, failover held for confirmation", m.Config.Name)
+		m.Status = StatusHeld
+		m.SuccCount = 0
+		e.saveState(m)
+		if e.OnSwitchHeld != nil {
+			e.goCallback("switch held", func() { e.OnSwitchHeld(m.ctx, m, true) })
+		}
+		return
+	}
+	markFailedOver(m)
+	e.saveState(m)
+	e.fireSwitch(m, true, reason)
+}
+
+// allowFailover records a failover against the window, or holds it when the limit is reached.
+func (e *Engine) allowFailover(m *Monitor, reason string) bool {
+	e.breakerMu.Lock()
+	now := time.Now()
+	e.pruneSwitchesLocked(now)
+	if !e.breaker.Enabled || len(e.recentSwitches) < e.breakerMax() {
+		e.recentSwitches = append(e.recentSwitches, now)
+		e.breakerMu.Unlock()
+		return true
+	}
+	e.breakerMu.Unlock()
+
+	e.holdFailover(m, reason, now)
+	return false
+}
+
+// holdFailover records a held failover for m, also when it is restored after a restart.
+func (e *Engine) holdFailover(m *Monitor, reason string, at time.Time) {
+	e.breakerMu.Lock()
+	defer e.breakerMu.Unlock()
+	e.held[m.Config.ID] = &heldSwitch{
+		HeldSwitch: HeldSwitch{
+			MonitorID: m.Config.ID,
+			Name:      m.Config.Name,
+			ToBackup:  true,
+			Reason:    reason,
+			HeldAt:    at.UnixMilli(),
+		},
+		m: m,
+	}
+}
+
+func (e *Engine) heldSwitch(id string) (HeldSwitch, bool) {
+	e.breakerMu.Lock()
+	defer e.breakerMu.Unlock()
+	h, ok := e.held[id]
+	if !ok {
+		return HeldSwitch{}, false
+	}
+	return h.HeldSwitch, true
+}
+
+func (e *Engine) pruneSwitchesLocked(now time.Time) {
+	cutoff := now.Add(-e.breakerWindow())
+	i := 0
+	for i < len(e.recentSwitches) && e.recentSwitches[i].Before(cutoff) {
+		i++
+	}
+	e.recentSwitches = e.recentSwitches[i:]
+}
+
+func (e *Engine) breakerMax() int {
+	if e.breaker.MaxSwitches <= 0 {
+		return 5
+	}
+	return e.breaker.MaxSwitches
+}
+
+func (e *Engine) breakerWindow() time.Duration {
+	if e.breaker.WindowMinutes <= 0 {
+		return 10 * time.Minute
+	}
+	return time.Duration(e.breaker.WindowMinutes) * time.Minute
+}
+
+// dropHeld removes a held switch for the monitor and reports whether one existed.
+func (e *Engine) dropHeld(id string) bool {
+	e.breakerMu.Lock()
+	defer e.breakerMu.Unlock()
+	if _, ok := e.held[id]; !ok {
+		return false
+	}
+	delete(e.held, id)
+	return true
+}
+
+// HeldSwitches lists failovers waiting for confirmation, oldest first.
+func (e *Engine) HeldSwitches() []HeldSwitch {
+	e.breakerMu.Lock()
+	defer e.breakerMu.Unlock()
+
+	out := make([]HeldSwitch, 0, len(e.held))
+	for _, h := range e.held {
+		out = append(out, h.HeldSwitch)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].HeldAt < out[j].HeldAt })
+	return out
+}
+
+// ConfirmHeldSwitch applies a held failover, bypassing the circuit breaker.
+func (e *Engine) ConfirmHeldSwitch(id string) error {
+	e.breakerMu.Lock()
+	h, ok := e.held[id]
+	if ok {
+		delete(e.held, id)
+		e.recentSwitches = append(e.recentSwitches, time.Now())
+	}
+	e.breakerMu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no held switch for monitor %s", id)
+	}
+
+	if h.m.ctx.Err() != nil || !e.isCurrent(h.m) {
+		return fmt.Errorf("monitor %s has been replaced or removed", id)
+	}
+
+	m := h.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Status != StatusHeld {
+		return fmt.Errorf("monitor %s is no longer waiting for a failover", id)
+	}
+	markFailedOver(m)
+	m.FailCount = 0
+	m.SuccCount = 0
+	e.saveState(m)
+	e.fireSwitch(m, true, h.Reason)
+	return nil
+}
+
+// DiscardHeldSwitch drops a held failover and returns the monitor to normal; DNS was never changed.
+func (e *Engine) DiscardHeldSwitch(id string) error {
+	e.breakerMu.Lock()
+	h, ok := e.held[id]
+	delete(e.held, id)
+	e.breakerMu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no held switch for monitor %s", id)
+	}
+
+	m := h.m
+	m.mu.Lock()
+	if m.Status == StatusHeld {
+		m.Status = StatusNormal
+	}
+	m.FailCount = 0
+	m.SuccCount = 0
+	e.saveState(m)
+	m.mu.Unlock()
+	return nil
+}
+
+// BreakerStatus returns the circuit breaker state for status output.
+func (e *Engine) BreakerStatus() map[string]interface{} {
+	e.breakerMu.Lock()
+	e.pruneSwitchesLocked(time.Now())
+	recent := len(e.recentSwitches)
+	status := map[string]interface{}{
+		"enabled":        e.breaker.Enabled,
+		"max_switches":   e.breakerMax(),
+		"window_minutes": int(e.breakerWindow() / time.Minute),
+		"recent":         recent,
+		"tripped":        e.breaker.Enabled && recent >= e.breakerMax(),
+	}
+	e.breakerMu.Unlock()
+
+	status["held"] = e.HeldSwitches()
+	return status
+}
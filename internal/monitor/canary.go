@@ -0,0 +1,185 @@
+package monitor
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"dns-failover/internal/config"
+)
+
+// SetCanaries replaces the canary configuration. Clearing the targets also clears the impaired state.
+func (e *Engine) SetCanaries(cfg config.CanaryConfig) {
+	e.netMu.Lock()
+	e.canary = cfg
+	e.canaryResults = make(map[string]bool)
+	recovered := e.impaired && (!cfg.Enabled || len(cfg.Targets) == 0)
+	if recovered {
+		e.impaired = false
+		e.impairedSince = time.Time{}
+	}
+	e.netMu.Unlock()
+
+	if recovered && e.OnNetworkImpaired != nil {
+		e.goCallback("network impaired", func() { e.OnNetworkImpaired(context.Background(), false) })
+	}
+}
+
+// RunCanaries probes the canary targets periodically until ctx is done.
+func (e *Engine) RunCanaries(ctx context.Context) {
+	for {
+		e.netMu.RLock()
+		interval := e.canary.Interval
+		e.netMu.RUnlock()
+		if interval <= 0 {
+			interval = 30
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(interval) * time.Second):
+			e.probeCanaries(ctx)
+		}
+	}
+}
+
+// NetworkImpaired reports whether all canaries are currently failing.
+func (e *Engine) NetworkImpaired() bool {
+	e.netMu.RLock()
+	defer e.netMu.RUnlock()
+	return e.impaired
+}
+
+// suspendFailure decides whether a failed check must be ignored because the local network is impaired.
+// When this failure would trigger a failover, the canaries are re-probed first so a fresh outage is caught.
+func (e *Engine) suspendFailure(ctx context.Context, m *Monitor) bool {
+	e.netMu.RLock()
+	enabled := e.canary.Enabled && len(e.canary.Targets) > 0
+	impaired := e.impaired
+	e.netMu.RUnlock()
+
+	if !enabled {
+		return false
+	}
+	if impaired {
+		return true
+	}
+
+	m.mu.RLock()
+	wouldSwitch := m.Status == StatusNormal && m.FailCount+1 >= m.Config.FailureThreshold
+	m.mu.RUnlock()
+	if !wouldSwitch {
+		return false
+	}
+	return e.probeCanaries(ctx)
+}
+
+// probeCanaries checks every canary target and updates the impaired state. It returns the new state.
+func (e *Engine) probeCanaries(ctx context.Context) bool {
+	e.netMu.RLock()
+	targets := append([]string(nil), e.canary.Targets...)
+	timeoutSeconds := e.canary.TimeoutSeconds
+	enabled := e.canary.Enabled
+	e.netMu.RUnlock()
+
+	if !enabled || len(targets) == 0 {
+		return false
+	}
+
+	results := make([]bool, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t string) {
+			defer wg.Done()
+			results[i] = Probe(ctx, canaryMonitorConfig(t, timeoutSeconds))
+		}(i, t)
+	}
+	wg.Wait()
+
+	// An aborted round says nothing about the network.
+	if ctx.Err() != nil {
+		return false
+	}
+
+	allFailed := true
+	for _, ok := range results {
+		if ok {
+			allFailed = false
+			break
+		}
+	}
+
+	e.netMu.Lock()
+	e.canaryResults = make(map[string]bool, len(targets))
+	for i, t := range targets {
+		e.canaryResults[t] = results[i]
+	}
+	changed := allFailed != e.impaired
+	e.impaired = allFailed
+	if changed && allFailed {
+		e.impairedSince = time.Now()
+	} else if changed {
+		e.impairedSince = time.Time{}
+	}
+	e.netMu.Unlock()
+
+	if changed {
+		if allFailed {
+			log.Printf("All %d canary targets failed, suspending failovers", len(targets))
+		} else {
+			log.Printf("Canary targets reachable again, resuming failovers")
+		}
+		if e.OnNetworkImpaired != nil {
+			e.goCallback("network impaired", func() { e.OnNetworkImpaired(ctx, allFailed) })
+		}
+	}
+	return allFailed
+}
+
+// NetworkStatus returns the canary state for status output.
+func (e *Engine) NetworkStatus() map[string]interface{} {
+	e.netMu.RLock()
+	defer e.netMu.RUnlock()
+
+	canaries := make([]map[string]interface{}, 0, len(e.canary.Targets))
+	for _, t := range e.canary.Targets {
+		item := map[string]interface{}{"target": t}
+		if ok, checked := e.canaryResults[t]; checked {
+			item["ok"] = ok
+		}
+		canaries = append(canaries, item)
+	}
+
+	var since int64
+	if !e.impairedSince.IsZero() {
+		since = e.impairedSince.UnixMilli()
+	}
+	return map[string]interface{}{
+		"enabled":  e.canary.Enabled,
+		"impaired": e.impaired,
+		"since":    since,
+		"canaries": canaries,
+	}
+}
+
+// canaryMonitorConfig picks a checker from the target format: URL -> http, host:port -> tcping, otherwise ping.
+func canaryMonitorConfig(target string, timeoutSeconds int) config.MonitorConfig {
+	cfg := config.MonitorConfig{
+		Name:           "canary " + target,
+		CheckType:      "ping",
+		CheckTarget:    target,
+		PingCount:      3,
+		TimeoutSeconds: timeoutSeconds,
+	}
+	if strings.Contains(target, "://") {
+		cfg.CheckType = "http"
+	} else if _, _, err := net.SplitHostPort(target); err == nil {
+		cfg.CheckType = "tcping"
+	}
+	return cfg
+}
@@ -0,0 +1,133 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"dns-failover/internal/config"
+)
+
+// probeCall is a probe shared by every monitor with the same probe key.
+type probeCall struct {
+	done   chan struct{}
+	result bool
+	at     time.Time
+	cancel context.CancelFunc
+	// waiters counts the callers waiting for the result; guarded by Engine.probeMu.
+	waiters int
+}
+
+// probeKey identifies probes that are interchangeable: same checker, target and parameters.
+func probeKey(cfg config.MonitorConfig) string {
+	target := cfg.CheckTarget
+	if target == "" {
+		target = cfg.OriginalIP
+	}
+	return fmt.Sprintf("%s|%s|%d|%d|%d|%d", cfg.CheckType, target, cfg.PingCount, cfg.TimeoutSeconds, cfg.Retries, cfg.RetryDelaySeconds)
+}
+
+// sharedProbe runs ProbeWithRetries, coalescing identical probes: a probe already in flight is joined,
+// and a result younger than the dedup window is reused instead of probing the endpoint again.
+// The shared probe outlives any single caller, so it runs under its own context, which is cancelled
+// once the last waiting caller's ctx is done. The returned channel is closed when the probe itself has
+// finished.
+func (e *Engine) sharedProbe(ctx context.Context, cfg config.MonitorConfig) (bool, <-chan struct{}) {
+	key := probeKey(cfg)
+	// Never reuse a result older than half this monitor's own interval.
+	window := e.dedupWindow()
+	if half := time.Duration(intervalSeconds(cfg)) * time.Second / 2; window > half {
+		window = half
+	}
+
+	e.probeMu.Lock()
+	c, joined := e.probes[key]
+	if joined {
+		select {
+		case <-c.done:
+			if time.Since(c.at) <= window {
+				e.probeMu.Unlock()
+				e.noteSharedProbe()
+				return c.result, c.done
+			}
+			joined = false
+		default:
+		}
+	}
+	if !joined {
+		probeCtx, cancel := context.WithCancel(e.baseContext())
+		c = &probeCall{done: make(chan struct{}), cancel: cancel}
+		e.probes[key] = c
+		go e.runProbe(probeCtx, key, c, cfg, window)
+	}
+	c.waiters++
+	e.probeMu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		e.leaveProbe(key, c)
+		return false, c.done
+	case <-c.done:
+		e.leaveProbe(key, c)
+		if joined {
+			e.noteSharedProbe()
+		}
+		return c.result, c.done
+	}
+}
+
+// runProbe runs the probe of c and keeps its result for reuse during the dedup window.
+func (e *Engine) runProbe(ctx context.Context, key string, c *probeCall, cfg config.MonitorConfig, window time.Duration) {
+	c.result = e.probe(ctx, cfg)
+	c.at = time.Now()
+	c.cancel()
+	close(c.done)
+
+	time.AfterFunc(window, func() {
+		e.probeMu.Lock()
+		if e.probes[key] == c {
+			delete(e.probes, key)
+		}
+		e.probeMu.Unlock()
+	})
+}
+
+// leaveProbe drops a caller from c's waiters. When the last one leaves before the result is in, the probe
+// is cancelled and forgotten, so its cut-short result is never reused.
+func (e *Engine) leaveProbe(key string, c *probeCall) {
+	e.probeMu.Lock()
+	defer e.probeMu.Unlock()
+	c.waiters--
+	if c.waiters > 0 {
+		return
+	}
+	select {
+	case <-c.done:
+	default:
+		if e.probes[key] == c {
+			delete(e.probes, key)
+		}
+		c.cancel()
+	}
+}
+
+func (e *Engine) dedupWindow() time.Duration {
+	e.schedMu.Lock()
+	seconds := e.scheduler.DedupWindowSeconds
+	e.schedMu.Unlock()
+
+	switch {
+	case seconds < 0:
+		return 0
+	case seconds == 0:
+		return 10 * time.Second
+	default:
+		return time.Duration(seconds) * time.Second
+	}
+}
+
+func (e *Engine) noteSharedProbe() {
+	e.schedMu.Lock()
+	e.stats.sharedProbes++
+	e.schedMu.Unlock()
+}
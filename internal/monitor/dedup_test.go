@@ -0,0 +1,47 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"dns-failover/internal/config"
+)
+
+func TestSharedProbeCancelledWithLastWaiter(t *testing.T) {
+	e := NewEngine()
+	started := make(chan struct{}, 1)
+	cancelled := make(chan struct{}, 1)
+	e.probe = func(ctx context.Context, _ config.MonitorConfig) bool {
+		started <- struct{}{}
+		<-ctx.Done()
+		cancelled <- struct{}{}
+		return false
+	}
+	wait := func(ch <-chan struct{}, what string) {
+		t.Helper()
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatal(what)
+		}
+	}
+	cfg := testMonitor("a", "http")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	returned := make(chan struct{})
+	go func() {
+		e.sharedProbe(ctx, cfg)
+		close(returned)
+	}()
+	wait(started, "probe never started")
+	cancel()
+	wait(cancelled, "probe kept running after its only waiter left")
+	wait(returned, "sharedProbe did not return")
+
+	// The cut-short result is not reused: the next check probes again.
+	next, stop := context.WithCancel(context.Background())
+	defer stop()
+	go e.sharedProbe(next, cfg)
+	wait(started, "cancelled probe was reused instead of probing again")
+}
@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"log"
+	"sort"
+)
+
+// blockedByParent handles a failed check for a monitor with parents. It returns true when the failure
+// must not count towards a failover: either a parent is down (the monitor becomes unreachable), or a
+// parent is failing and may be about to go down, in which case the child waits for it.
+func (e *Engine) blockedByParent(m *Monitor) bool {
+	if len(m.Config.ParentIDs) == 0 {
+		return false
+	}
+	parent, suspect := e.parentState(m)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Status == StatusDown || m.Status == StatusHeld {
+		return false
+	}
+	if parent != nil {
+		if m.Status != StatusUnreachable {
+			log.Printf("Monitor %s: unreachable (parent %s down)", m.Config.Name, parent.Config.Name)
+		}
+		m.Status = StatusUnreachable
+		m.BlockedBy = parent.Config.ID
+		m.FailCount = 0
+		return true
+	}
+	if m.Status == StatusUnreachable {
+		// The parent has recovered but this monitor is still failing: count it on its own from now on.
+		m.Status = StatusNormal
+		m.BlockedBy = ""
+	}
+	if suspect && m.FailCount+1 >= m.Config.FailureThreshold {
+		log.Printf("Monitor %s: parent is failing, deferring failover", m.Config.Name)
+		return true
+	}
+	return false
+}
+
+// parentState returns the first parent that is down or itself unreachable, and whether any parent is
+// currently accumulating failures.
+func (e *Engine) parentState(m *Monitor) (down *Monitor, suspect bool) {
+	e.mu.RLock()
+	parents := make([]*Monitor, 0, len(m.Config.ParentIDs))
+	for _, id := range m.Config.ParentIDs {
+		if p := e.Monitors[id]; p != nil && p != m {
+			parents = append(parents, p)
+		}
+	}
+	e.mu.RUnlock()
+
+	for _, p := range parents {
+		p.mu.RLock()
+		status, failCount := p.Status, p.FailCount
+		p.mu.RUnlock()
+
+		if status == StatusDown || status == StatusHeld || status == StatusUnreachable {
+			return p, false
+		}
+		if failCount > 0 {
+			suspect = true
+		}
+	}
+	return nil, suspect
+}
+
+// Dependents returns the names of monitors that declare id as a parent.
+func (e *Engine) Dependents(id string) []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	out := make([]string, 0)
+	for _, m := range e.Monitors {
+		for _, pid := range m.Config.ParentIDs {
+			if pid == id {
+				out = append(out, m.Config.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -3,9 +3,9 @@ package monitor
 import (
 	"context"
 	"log"
-	"net"       // 新增：用于 TCP 连接
+	"net" // 新增：用于 TCP 连接
 	"net/http"
-	"strings"   // 新增：用于字符串处理
+	"strings" // 新增：用于字符串处理
 	"sync"
 	"time"
 
@@ -19,6 +19,11 @@ type Status string
 const (
 	StatusNormal Status = "Normal"
 	StatusDown   Status = "Down"
+	// StatusUnreachable means the monitor is failing only because one of its parents is down.
+	StatusUnreachable Status = "Unreachable"
+	// StatusHeld means the monitor should fail over but the circuit breaker holds the switch until it is
+	// confirmed; DNS, and CurrentIP, still point at the original.
+	StatusHeld Status = "Held"
 )
 
 type Monitor struct {
@@ -30,29 +35,133 @@ type Monitor struct {
 
 	BackupFailCount int
 	BackupDown      bool
-	mu        sync.RWMutex
+	// BlockedBy is the parent monitor ID while Status is StatusUnreachable.
+	BlockedBy string
+	// LastHeartbeat is the last time a push monitor received a heartbeat.
+	LastHeartbeat time.Time
+	// QuorumUnavailable is set while fewer locations than the quorum requires report fresh results; the
+	// local probe decides meanwhile.
+	QuorumUnavailable bool
+	// ExternalHold is set while an external alert keeps the monitor failed over; automatic restore is paused.
+	ExternalHold bool
+	// OriginalHealthy is set when the original IP passed its checks but the restore policy keeps the
+	// monitor on backup. RestoreApproved records an approval for the "auto-after-approval" policy.
+	OriginalHealthy bool
+	RestoreApproved bool
+	// ctx is cancelled when the monitor is stopped or replaced; a stale monitor must never switch DNS.
+	ctx context.Context
+	// SwitchedAt is when the monitor last failed over. StableSince/StableFailures track the restore
+	// stabilization window during which the original must stay healthy.
+	SwitchedAt     time.Time
+	StableSince    time.Time
+	StableFailures int
+	mu             sync.RWMutex
 }
 
 type Engine struct {
 	Monitors map[string]*Monitor
-	OnSwitch func(m *Monitor, toBackup bool)
+	// Callbacks receive the monitor's context, which is cancelled once the monitor is stopped or replaced.
+
+	// OnSwitch is called when a monitor fails over or restores. reason is "failover", "restore" or "external".
+	OnSwitch func(ctx context.Context, m *Monitor, toBackup bool, reason string)
 	// OnScheduledSwitch is called when a monitor performs a scheduled switch (not a failover).
 	// It receives the from/to IP so the caller can update DNS and write history.
-	OnScheduledSwitch func(m *Monitor, fromIP, toIP string)
+	OnScheduledSwitch func(ctx context.Context, m *Monitor, fromIP, toIP string)
 	// OnIPDown is called when original/backup IP is considered down (transition event).
-	OnIPDown func(m *Monitor, ip, role string)
-	mu       sync.RWMutex
-	cancels  map[string]context.CancelFunc
+	OnIPDown func(ctx context.Context, m *Monitor, ip, role string)
+	// OnNetworkImpaired is called once when all canary targets fail (true) and once when they recover (false).
+	OnNetworkImpaired func(ctx context.Context, impaired bool)
+	// OnQuorumUnavailable is called when a monitor loses (true) or regains (false) enough fresh voters for a
+	// quorum decision.
+	OnQuorumUnavailable func(ctx context.Context, m *Monitor, unavailable bool, voters, required int)
+	// OnSwitchHeld is called when the circuit breaker holds a failover until it is confirmed via API.
+	OnSwitchHeld func(ctx context.Context, m *Monitor, toBackup bool)
+	// OnOriginalRecovered is called once when the original IP is healthy again but the restore policy
+	// requires an operator to restore (or approve restoring) it.
+	OnOriginalRecovered func(ctx context.Context, m *Monitor)
+	// OnStateChange is called synchronously, with the monitor locked, whenever its switching state changes,
+	// so the caller can persist it in order (see ResumeMonitor). It must not call back into the engine, and
+	// should only queue the state: every other check of the monitor waits for it.
+	OnStateChange func(id string, st config.MonitorState)
+
+	mu      sync.RWMutex
+	cancels map[string]context.CancelFunc
+	// monitorsGen counts monitors being started, replaced or stopped; guarded by mu.
+	monitorsGen uint64
+
+	// Remote probe agents and the quorum rule that combines their votes.
+	agentMu sync.RWMutex
+	agents  map[string]*agentState
+	quorum  config.QuorumConfig
+
+	// Canary targets used to detect that the monitoring host itself lost connectivity.
+	netMu         sync.RWMutex
+	canary        config.CanaryConfig
+	canaryResults map[string]bool
+	impaired      bool
+	impairedSince time.Time
+
+	// Engine-wide circuit breaker limiting how many failovers may happen within a window.
+	breakerMu      sync.Mutex
+	breaker        config.CircuitBreakerConfig
+	recentSwitches []time.Time
+	held           map[string]*heldSwitch
+
+	// Central scheduler: a heap of due jobs feeding a bounded worker pool.
+	schedMu   sync.Mutex
+	scheduler config.SchedulerConfig
+	queue     jobQueue
+	wake      chan struct{}
+	work      chan *job
+	stats     schedulerStats
+	baseCtx   context.Context
+	workers   sync.WaitGroup
+
+	// Per check type concurrency: limits, checks running, and due checks waiting for a slot.
+	typeLimit   map[string]int
+	typeRunning map[string]int
+	typeWaiting map[string][]*job
+
+	// Callbacks still running (DNS updates, notifications), drained by Shutdown.
+	cbMu      sync.Mutex
+	cbClosed  bool
+	callbacks sync.WaitGroup
+
+	// In-flight and recent probe results shared by monitors probing the same endpoint.
+	probeMu sync.Mutex
+	probes  map[string]*probeCall
+	probe   func(ctx context.Context, cfg config.MonitorConfig) bool // ProbeWithRetries; replaced in tests
 }
 
 func NewEngine() *Engine {
 	return &Engine{
 		Monitors: make(map[string]*Monitor),
 		cancels:  make(map[string]context.CancelFunc),
+		agents:   make(map[string]*agentState),
+
+		canaryResults: make(map[string]bool),
+		held:          make(map[string]*heldSwitch),
+
+		wake: make(chan struct{}, 1),
+		work: make(chan *job),
+
+		probes: make(map[string]*probeCall),
+		probe:  ProbeWithRetries,
 	}
 }
 
+// StartMonitor starts (or restarts, after a config change) a monitor on its original IP.
 func (e *Engine) StartMonitor(ctx context.Context, cfg config.MonitorConfig) {
+	e.startMonitor(ctx, cfg, nil)
+}
+
+// ResumeMonitor starts a monitor in the state persisted before a restart. A state that no longer fits the
+// monitor's configuration, e.g. because its IPs changed, is ignored and the monitor starts fresh.
+func (e *Engine) ResumeMonitor(ctx context.Context, cfg config.MonitorConfig, st config.MonitorState) {
+	e.startMonitor(ctx, cfg, &st)
+}
+
+func (e *Engine) startMonitor(ctx context.Context, cfg config.MonitorConfig, st *config.MonitorState) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
@@ -67,12 +176,25 @@ func (e *Engine) StartMonitor(ctx context.Context, cfg config.MonitorConfig) {
 		Config:    cfg,
 		Status:    StatusNormal,
 		CurrentIP: cfg.OriginalIP,
+		// Push monitors get a full interval plus grace after (re)start before they can fail.
+		LastHeartbeat: time.Now(),
+		ctx:           mCtx,
+	}
+	// A held switch belongs to the monitor instance that raised it.
+	e.dropHeld(cfg.ID)
+	if st != nil {
+		resumeState(m, *st)
+		if m.Status == StatusHeld {
+			e.holdFailover(m, st.HeldReason, time.UnixMilli(st.HeldAt))
+		}
 	}
 	e.Monitors[cfg.ID] = m
+	e.monitorsGen++
+	e.saveState(m)
 
-	go e.run(mCtx, m)
+	e.schedule(&job{due: time.Now().Add(checkPhase(cfg)), kind: jobCheck, m: m})
 	if cfg.ScheduleEnabled && cfg.ScheduleHours > 0 {
-		go e.runSchedule(mCtx, m)
+		e.schedule(&job{due: time.Now().Add(time.Duration(cfg.ScheduleHours) * time.Hour), kind: jobSchedule, m: m})
 	}
 }
 
@@ -84,7 +206,9 @@ func (e *Engine) StopMonitor(id string) {
 		cancel()
 		delete(e.cancels, id)
 		delete(e.Monitors, id)
+		e.monitorsGen++
 	}
+	e.dropHeld(id)
 }
 
 func (e *Engine) ForceRestore(id string) (fromIP string, ok bool) {
@@ -95,57 +219,34 @@ func (e *Engine) ForceRestore(id string) (fromIP string, ok bool) {
 		return "", false
 	}
 
+	// A held failover never reached DNS, so it must not be applied after a manual restore.
+	e.dropHeld(id)
+
 	m.mu.Lock()
 	fromIP = m.CurrentIP
 	m.Status = StatusNormal
 	m.CurrentIP = m.Config.OriginalIP
 	m.FailCount = 0
 	m.SuccCount = 0
+	m.ExternalHold = false
+	m.OriginalHealthy = false
+	m.RestoreApproved = false
+	m.StableSince = time.Time{}
+	m.StableFailures = 0
+	e.saveState(m)
 	m.mu.Unlock()
 
 	return fromIP, true
 }
 
-func (e *Engine) run(ctx context.Context, m *Monitor) {
-	interval := m.Config.Interval
-	if interval <= 0 {
-		interval = 60
-	}
-	ticker := time.NewTicker(time.Duration(interval) * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			e.check(m)
-		}
-	}
-}
-
-func (e *Engine) runSchedule(ctx context.Context, m *Monitor) {
-	hours := m.Config.ScheduleHours
-	if hours <= 0 {
+func (e *Engine) scheduledSwitch(m *Monitor) {
+	if m.ctx.Err() != nil {
 		return
 	}
-	ticker := time.NewTicker(time.Duration(hours) * time.Hour)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			e.scheduledSwitch(m)
-		}
-	}
-}
 
-func (e *Engine) scheduledSwitch(m *Monitor) {
 	m.mu.Lock()
-	// Avoid interfering while failover is active.
-	if m.Status == StatusDown {
+	// Avoid interfering while failover is active or waiting for confirmation.
+	if m.Status == StatusDown || m.Status == StatusHeld {
 		m.mu.Unlock()
 		return
 	}
@@ -168,22 +269,37 @@ func (e *Engine) scheduledSwitch(m *Monitor) {
 	m.CurrentIP = toIP
 	m.FailCount = 0
 	m.SuccCount = 0
+	e.saveState(m)
 	m.mu.Unlock()
 
 	if e.OnScheduledSwitch != nil {
-		go e.OnScheduledSwitch(m, fromIP, toIP)
+		e.goCallback("scheduled switch", func() { e.OnScheduledSwitch(m.ctx, m, fromIP, toIP) })
 	}
 }
 
-func (e *Engine) check(m *Monitor) {
+// check runs one health check for m. It returns a channel closed once the probe behind the check has
+// finished, which can be later than check itself when m was stopped meanwhile; nil when nothing was probed.
+func (e *Engine) check(m *Monitor) (probeDone <-chan struct{}) {
+	ctx := m.ctx
 	var success bool
-	switch m.Config.CheckType {
-	case "http", "https":
-		success = e.checkHTTP(m)
-	case "tcping":               // 新增：TCPing 分支
-		success = e.checkTCP(m)
-	default: // ping
-		success = e.checkPing(m)
+	if m.Config.CheckType == "push" {
+		success = e.checkPush(m)
+	} else {
+		success, probeDone = e.sharedProbe(ctx, m.Config)
+		success = e.applyQuorum(m, success)
+	}
+
+	// The monitor was stopped or replaced while probing: its result must not touch any state.
+	if ctx.Err() != nil {
+		return probeDone
+	}
+
+	if !success && e.suspendFailure(ctx, m) {
+		log.Printf("Monitor %s: check failed while local network is impaired, ignoring", m.Config.Name)
+		return probeDone
+	}
+	if !success && e.blockedByParent(m) {
+		return probeDone
 	}
 
 	if success {
@@ -193,10 +309,49 @@ func (e *Engine) check(m *Monitor) {
 	}
 
 	// When failover is active, also watch the backup IP health (ping only) so we can surface alerts.
-	e.checkBackupHealth(m)
+	e.checkBackupHealth(ctx, m)
+	return probeDone
+}
+
+// Probe runs the configured checker for a monitor once and reports whether the target is healthy.
+// It is shared by the engine and by remote probe agents. A cancelled ctx aborts the probe as failed.
+func Probe(ctx context.Context, cfg config.MonitorConfig) bool {
+	switch cfg.CheckType {
+	case "http", "https":
+		return checkHTTP(ctx, cfg)
+	case "tcping": // 新增：TCPing 分支
+		return checkTCP(ctx, cfg)
+	default: // ping
+		return checkPing(ctx, cfg)
+	}
+}
+
+// ProbeWithRetries runs Probe and, on failure, retries up to cfg.Retries times within the same check
+// cycle, waiting cfg.RetryDelaySeconds between attempts.
+func ProbeWithRetries(ctx context.Context, cfg config.MonitorConfig) bool {
+	if Probe(ctx, cfg) {
+		return true
+	}
+	for i := 0; i < cfg.Retries; i++ {
+		if cfg.RetryDelaySeconds > 0 {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-time.After(time.Duration(cfg.RetryDelaySeconds) * time.Second):
+			}
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		log.Printf("Monitor %s: retry %d/%d", cfg.Name, i+1, cfg.Retries)
+		if Probe(ctx, cfg) {
+			return true
+		}
+	}
+	return false
 }
 
-func (e *Engine) checkBackupHealth(m *Monitor) {
+func (e *Engine) checkBackupHealth(ctx context.Context, m *Monitor) {
 	m.mu.RLock()
 	shouldCheck := m.Status == StatusDown && m.Config.CheckType == "ping" && m.Config.BackupIP != ""
 	backupIP := m.Config.BackupIP
@@ -228,7 +383,10 @@ func (e *Engine) checkBackupHealth(m *Monitor) {
 	pinger.Timeout = time.Second * time.Duration(timeoutSeconds)
 	pinger.SetPrivileged(false)
 
-	if err := pinger.Run(); err != nil {
+	if err := pinger.RunWithContext(ctx); err != nil || ctx.Err() != nil {
+		if ctx.Err() != nil {
+			return
+		}
 		// Treat as failure.
 	} else {
 		stats := pinger.Statistics()
@@ -255,35 +413,35 @@ func (e *Engine) checkBackupHealth(m *Monitor) {
 	m.mu.Unlock()
 
 	if trigger && e.OnIPDown != nil {
-		go e.OnIPDown(m, backupIP, "backup")
+		e.goCallback("ip down", func() { e.OnIPDown(ctx, m, backupIP, "backup") })
 	}
 }
 
-func (e *Engine) checkPing(m *Monitor) bool {
-	target := m.Config.CheckTarget
+func checkPing(ctx context.Context, cfg config.MonitorConfig) bool {
+	target := cfg.CheckTarget
 	if target == "" {
-		target = m.Config.OriginalIP
+		target = cfg.OriginalIP
 	}
 	pinger, err := probing.NewPinger(target)
 	if err != nil {
-		log.Printf("Failed to create pinger for %s: %v", m.Config.Name, err)
+		log.Printf("Failed to create pinger for %s: %v", cfg.Name, err)
 		return false
 	}
 
-	pinger.Count = m.Config.PingCount
+	pinger.Count = cfg.PingCount
 	if pinger.Count <= 0 {
 		pinger.Count = 5
 	}
-	timeoutSeconds := m.Config.TimeoutSeconds
+	timeoutSeconds := cfg.TimeoutSeconds
 	if timeoutSeconds <= 0 {
 		timeoutSeconds = 2
 	}
 	pinger.Timeout = time.Second * time.Duration(timeoutSeconds)
 	pinger.SetPrivileged(false)
 
-	err = pinger.Run()
+	err = pinger.RunWithContext(ctx)
 	if err != nil {
-		log.Printf("Ping error for %s: %v", m.Config.Name, err)
+		log.Printf("Ping error for %s: %v", cfg.Name, err)
 		return false
 	}
 
@@ -291,13 +449,13 @@ func (e *Engine) checkPing(m *Monitor) bool {
 	return stats.PacketLoss < 60.0
 }
 
-func (e *Engine) checkHTTP(m *Monitor) bool {
-	target := m.Config.CheckTarget
+func checkHTTP(ctx context.Context, cfg config.MonitorConfig) bool {
+	target := cfg.CheckTarget
 	if target == "" {
 		return false
 	}
 
-	timeoutSeconds := m.Config.TimeoutSeconds
+	timeoutSeconds := cfg.TimeoutSeconds
 	if timeoutSeconds <= 0 {
 		timeoutSeconds = 10
 	}
@@ -305,9 +463,14 @@ func (e *Engine) checkHTTP(m *Monitor) bool {
 		Timeout: time.Second * time.Duration(timeoutSeconds),
 	}
 
-	resp, err := client.Get(target)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		log.Printf("HTTP check error for %s: %v", cfg.Name, err)
+		return false
+	}
+	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("HTTP check error for %s: %v", m.Config.Name, err)
+		log.Printf("HTTP check error for %s: %v", cfg.Name, err)
 		return false
 	}
 	defer resp.Body.Close()
@@ -315,12 +478,11 @@ func (e *Engine) checkHTTP(m *Monitor) bool {
 	return resp.StatusCode >= 200 && resp.StatusCode < 400
 }
 
-
-func (e *Engine) checkTCP(m *Monitor) bool {
-	target := m.Config.CheckTarget
+func checkTCP(ctx context.Context, cfg config.MonitorConfig) bool {
+	target := cfg.CheckTarget
 	// 如果用户没有填写检测目标，默认使用主IP
 	if target == "" {
-		target = m.Config.OriginalIP
+		target = cfg.OriginalIP
 	}
 
 	// TCP 检测必须有端口，如果用户没有带冒号，默认追加 :80 端口
@@ -328,15 +490,16 @@ func (e *Engine) checkTCP(m *Monitor) bool {
 		target = target + ":80"
 	}
 
-	timeoutSeconds := m.Config.TimeoutSeconds
+	timeoutSeconds := cfg.TimeoutSeconds
 	if timeoutSeconds <= 0 {
 		timeoutSeconds = 2
 	}
 
 	// 尝试建立 TCP 连接
-	conn, err := net.DialTimeout("tcp", target, time.Second*time.Duration(timeoutSeconds))
+	dialer := net.Dialer{Timeout: time.Second * time.Duration(timeoutSeconds)}
+	conn, err := dialer.DialContext(ctx, "tcp", target)
 	if err != nil {
-		log.Printf("TCP check error for %s (%s): %v", m.Config.Name, target, err)
+		log.Printf("TCP check error for %s (%s): %v", cfg.Name, target, err)
 		return false
 	}
 	defer conn.Close()
@@ -352,17 +515,18 @@ func (e *Engine) handleFailure(m *Monitor) {
 		log.Printf("Monitor %s: failure count %d/%d", m.Config.Name, m.FailCount, m.Config.FailureThreshold)
 		if m.FailCount >= m.Config.FailureThreshold {
 			if e.OnIPDown != nil {
-				go e.OnIPDown(m, m.Config.OriginalIP, "original")
+				e.goCallback("ip down", func() { e.OnIPDown(m.ctx, m, m.Config.OriginalIP, "original") })
 			}
-			m.Status = StatusDown
-			m.CurrentIP = m.Config.BackupIP
 			m.FailCount = 0
-			if e.OnSwitch != nil {
-				go e.OnSwitch(m, true)
-			}
+			e.failOver(m, "failover")
 		}
+	} else if m.Status == StatusHeld {
+		// Still failing while the failover waits for confirmation.
+		m.SuccCount = 0
 	} else {
 		m.SuccCount = 0
+		m.OriginalHealthy = false
+		noteStabilizationFailure(m)
 	}
 }
 
@@ -370,22 +534,144 @@ func (e *Engine) handleSuccess(m *Monitor) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if m.Status == StatusDown {
+	if m.Status == StatusHeld {
+		if m.ExternalHold {
+			return
+		}
 		m.SuccCount++
-		log.Printf("Monitor %s: success count %d/%d", m.Config.Name, m.SuccCount, m.Config.SuccessThreshold)
 		if m.SuccCount >= m.Config.SuccessThreshold {
+			// The failover was never applied to DNS, so there is nothing to restore.
+			log.Printf("Monitor %s: recovered before held failover was confirmed, discarding it", m.Config.Name)
+			e.dropHeld(m.Config.ID)
 			m.Status = StatusNormal
-			m.CurrentIP = m.Config.OriginalIP
 			m.SuccCount = 0
-			if e.OnSwitch != nil {
-				go e.OnSwitch(m, false)
-			}
+			m.FailCount = 0
+			e.saveState(m)
+		}
+		return
+	}
+
+	if m.Status == StatusDown {
+		if m.ExternalHold {
+			return
+		}
+		if m.StableSince.IsZero() {
+			m.StableSince = time.Now()
+		}
+		m.SuccCount++
+		log.Printf("Monitor %s: success count %d/%d", m.Config.Name, m.SuccCount, m.Config.SuccessThreshold)
+		if m.SuccCount >= m.Config.SuccessThreshold && restoreWindowElapsed(m, time.Now()) {
+			e.restoreOrWait(m, "restore")
 		}
 	} else {
+		if m.Status == StatusUnreachable {
+			log.Printf("Monitor %s: reachable again", m.Config.Name)
+			m.Status = StatusNormal
+			m.BlockedBy = ""
+		}
 		m.FailCount = 0
 	}
 }
 
+// saveState hands the monitor's switching state to OnStateChange. Callers hold m.mu. A stopped or replaced
+// monitor no longer owns its state and is ignored.
+func (e *Engine) saveState(m *Monitor) {
+	if e.OnStateChange == nil || m.ctx.Err() != nil {
+		return
+	}
+	st := config.MonitorState{
+		Status:          string(m.Status),
+		CurrentIP:       m.CurrentIP,
+		ExternalHold:    m.ExternalHold,
+		RestoreApproved: m.RestoreApproved,
+	}
+	if !m.SwitchedAt.IsZero() {
+		st.SwitchedAt = m.SwitchedAt.UnixMilli()
+	}
+	if m.Status == StatusHeld {
+		if h, ok := e.heldSwitch(m.Config.ID); ok {
+			st.HeldAt, st.HeldReason = h.HeldAt, h.Reason
+		}
+	}
+	e.OnStateChange(m.Config.ID, st)
+}
+
+// resumeState applies a persisted state to a monitor that is being started.
+func resumeState(m *Monitor, st config.MonitorState) {
+	cfg := m.Config
+	switch Status(st.Status) {
+	case StatusHeld:
+		m.Status = StatusHeld
+		m.ExternalHold = st.ExternalHold
+		if st.CurrentIP != "" && (st.CurrentIP == cfg.BackupIP || st.CurrentIP == cfg.ScheduleSwitchIP) {
+			m.CurrentIP = st.CurrentIP
+		}
+	case StatusDown:
+		if st.CurrentIP == "" || st.CurrentIP != cfg.BackupIP {
+			return
+		}
+		m.Status = StatusDown
+		m.CurrentIP = st.CurrentIP
+		m.ExternalHold = st.ExternalHold
+		m.RestoreApproved = st.RestoreApproved
+		if st.SwitchedAt > 0 {
+			m.SwitchedAt = time.UnixMilli(st.SwitchedAt)
+		}
+	default:
+		// Normal or unreachable: only a scheduled switch can have moved the monitor off its original IP.
+		if st.CurrentIP != "" && (st.CurrentIP == cfg.BackupIP || st.CurrentIP == cfg.ScheduleSwitchIP) {
+			m.CurrentIP = st.CurrentIP
+		}
+	}
+}
+
+// MonitorState is a point-in-time copy of a monitor's switching state.
+type MonitorState struct {
+	Config     config.MonitorConfig
+	Status     Status
+	CurrentIP  string
+	BackupDown bool
+}
+
+// Snapshot returns the current state of every monitor.
+func (e *Engine) Snapshot() []MonitorState {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	out := make([]MonitorState, 0, len(e.Monitors))
+	for _, m := range e.Monitors {
+		m.mu.RLock()
+		out = append(out, MonitorState{Config: m.Config, Status: m.Status, CurrentIP: m.CurrentIP, BackupDown: m.BackupDown})
+		m.mu.RUnlock()
+	}
+	return out
+}
+
+// States returns the current state of the given monitors, skipping IDs that are not running.
+func (e *Engine) States(ids []string) []MonitorState {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	out := make([]MonitorState, 0, len(ids))
+	for _, id := range ids {
+		m := e.Monitors[id]
+		if m == nil {
+			continue
+		}
+		m.mu.RLock()
+		out = append(out, MonitorState{Config: m.Config, Status: m.Status, CurrentIP: m.CurrentIP, BackupDown: m.BackupDown})
+		m.mu.RUnlock()
+	}
+	return out
+}
+
+// MonitorsGeneration changes whenever a monitor is started, replaced with a new config or stopped.
+func (e *Engine) MonitorsGeneration() uint64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.monitorsGen
+}
+
 func (e *Engine) GetStatus() []map[string]interface{} {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
@@ -393,15 +679,31 @@ func (e *Engine) GetStatus() []map[string]interface{} {
 	res := make([]map[string]interface{}, 0)
 	for _, m := range e.Monitors {
 		m.mu.RLock()
-		res = append(res, map[string]interface{}{
-			"id":         m.Config.ID,
-			"name":       m.Config.Name,
-			"status":     m.Status,
-			"current_ip": m.CurrentIP,
-			"fail_count": m.FailCount,
-			"succ_count": m.SuccCount,
-			"check_type": m.Config.CheckType,
-		})
+		item := map[string]interface{}{
+			"id":                 m.Config.ID,
+			"name":               m.Config.Name,
+			"status":             m.Status,
+			"current_ip":         m.CurrentIP,
+			"fail_count":         m.FailCount,
+			"succ_count":         m.SuccCount,
+			"check_type":         m.Config.CheckType,
+			"parent_ids":         m.Config.ParentIDs,
+			"blocked_by":         m.BlockedBy,
+			"external":           m.ExternalHold,
+			"quorum_unavailable": m.QuorumUnavailable,
+			"restore_policy":     restorePolicy(m.Config),
+			"original_healthy":   m.OriginalHealthy,
+			"restore_approved":   m.RestoreApproved,
+		}
+		if m.Status == StatusDown {
+			hold, stabilization := restoreCountdown(m, time.Now())
+			item["hold_remaining"] = hold
+			item["stabilization_remaining"] = stabilization
+		}
+		if m.Config.CheckType == "push" {
+			item["last_heartbeat"] = m.LastHeartbeat.UnixMilli()
+		}
+		res = append(res, item)
 		m.mu.RUnlock()
 	}
 	return res
@@ -0,0 +1,84 @@
+package monitor
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// ExternalSwitch fails over or restores a monitor on behalf of an external alerting system.
+// It goes through the same path as automatic switches, with reason "external". A failover pins the
+// monitor on the backup IP until ExternalRelease or ExternalSwitch(id, false) is called; the latter
+// restores only as far as the monitor's restore policy and restore windows allow.
+func (e *Engine) ExternalSwitch(id string, toBackup bool) (bool, error) {
+	e.mu.RLock()
+	m := e.Monitors[id]
+	e.mu.RUnlock()
+	if m == nil {
+		return false, fmt.Errorf("monitor %s not found", id)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if toBackup {
+		m.ExternalHold = true
+		if m.Status == StatusDown || m.Status == StatusHeld {
+			e.saveState(m)
+			return false, nil
+		}
+		log.Printf("Monitor %s: external alert firing, failing over", m.Config.Name)
+		m.BlockedBy = ""
+		m.FailCount = 0
+		m.SuccCount = 0
+		e.failOver(m, "external")
+		return true, nil
+	}
+
+	m.ExternalHold = false
+	if m.Status == StatusHeld {
+		log.Printf("Monitor %s: external alert resolved before held failover was confirmed, discarding it", m.Config.Name)
+		e.dropHeld(m.Config.ID)
+		m.Status = StatusNormal
+		m.FailCount = 0
+		m.SuccCount = 0
+		e.saveState(m)
+		return true, nil
+	}
+	if m.Status != StatusDown {
+		e.saveState(m)
+		return false, nil
+	}
+	// The resolved alert stands in for the success checks, but the restore policy, the minimum hold time
+	// and the stabilization window still apply. Until they allow it, the monitor's own checks take over.
+	m.FailCount = 0
+	m.SuccCount = 0
+	if !restoreWindowElapsed(m, time.Now()) {
+		log.Printf("Monitor %s: external alert resolved, restoring once the hold time and stabilization window allow", m.Config.Name)
+		e.saveState(m)
+		return false, nil
+	}
+	log.Printf("Monitor %s: external alert resolved", m.Config.Name)
+	e.restoreOrWait(m, "external")
+	if m.Status == StatusDown {
+		e.saveState(m)
+		return false, nil
+	}
+	return true, nil
+}
+
+// ExternalRelease clears the external hold without switching, handing the monitor back to its own checks.
+func (e *Engine) ExternalRelease(id string) error {
+	e.mu.RLock()
+	m := e.Monitors[id]
+	e.mu.RUnlock()
+	if m == nil {
+		return fmt.Errorf("monitor %s not found", id)
+	}
+
+	m.mu.Lock()
+	m.ExternalHold = false
+	e.saveState(m)
+	m.mu.Unlock()
+	return nil
+}
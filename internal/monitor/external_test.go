@@ -0,0 +1,67 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"dns-failover/internal/config"
+)
+
+func TestExternalResolveFollowsRestorePolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      func(*config.MonitorConfig)
+		restored bool
+	}{
+		{"auto", func(*config.MonitorConfig) {}, true},
+		{"manual", func(c *config.MonitorConfig) { c.RestorePolicy = RestoreManual }, false},
+		{"awaiting approval", func(c *config.MonitorConfig) { c.RestorePolicy = RestoreAutoAfterApproval }, false},
+		{"hold time", func(c *config.MonitorConfig) { c.MinHoldSeconds = 3600 }, false},
+		{"stabilization", func(c *config.MonitorConfig) { c.StabilizationSeconds = 60 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			e := NewEngine()
+			switches := make(chan string, 1)
+			e.OnSwitch = func(_ context.Context, _ *Monitor, _ bool, reason string) { switches <- reason }
+
+			cfg := config.MonitorConfig{ID: "a", Name: "a", OriginalIP: "192.0.2.1", BackupIP: "192.0.2.2", SuccessThreshold: 1}
+			tt.cfg(&cfg)
+			m := &Monitor{Config: cfg, ExternalHold: true, ctx: ctx}
+			markFailedOver(m)
+			e.Monitors[cfg.ID] = m
+
+			switched, err := e.ExternalSwitch("a", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if switched != tt.restored {
+				t.Fatalf("switched = %v, want %v", switched, tt.restored)
+			}
+			m.mu.RLock()
+			status, hold := m.Status, m.ExternalHold
+			m.mu.RUnlock()
+			if hold {
+				t.Error("external hold not released")
+			}
+			if !tt.restored {
+				if status != StatusDown {
+					t.Errorf("status = %s, want the monitor to stay failed over", status)
+				}
+				return
+			}
+			select {
+			case reason := <-switches:
+				if reason != "external" {
+					t.Errorf("switch reason = %q, want external", reason)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("restore was not fired")
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package monitor
+
+import (
+	"time"
+)
+
+// Heartbeat records a heartbeat for the push monitor owning token. It returns false for unknown tokens.
+func (e *Engine) Heartbeat(token string) bool {
+	if token == "" {
+		return false
+	}
+
+	e.mu.RLock()
+	var target *Monitor
+	for _, m := range e.Monitors {
+		if m.Config.CheckType == "push" && m.Config.PushToken == token {
+			target = m
+			break
+		}
+	}
+	e.mu.RUnlock()
+
+	if target == nil {
+		return false
+	}
+	target.mu.Lock()
+	target.LastHeartbeat = time.Now()
+	target.mu.Unlock()
+	return true
+}
+
+// checkPush treats a push monitor as healthy while its last heartbeat is within interval plus grace.
+func (e *Engine) checkPush(m *Monitor) bool {
+	grace := m.Config.PushGraceSeconds
+	if grace <= 0 {
+		grace = 30
+	}
+	deadline := time.Duration(intervalSeconds(m.Config)+grace) * time.Second
+
+	m.mu.RLock()
+	last := m.LastHeartbeat
+	m.mu.RUnlock()
+
+	return time.Since(last) <= deadline
+}
@@ -0,0 +1,187 @@
+package monitor
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"dns-failover/internal/config"
+)
+
+// localLocation is the location name used for the server's own probe when it takes part in a quorum vote.
+const localLocation = "local"
+
+// AgentResult is a single probe result reported by a remote agent.
+type AgentResult struct {
+	MonitorID string `json:"monitor_id"`
+	Success   bool   `json:"success"`
+	CheckedAt int64  `json:"checked_at"` // unix millis
+}
+
+type agentState struct {
+	ID       string
+	Name     string
+	Location string
+	LastSeen time.Time
+	Results  map[string]AgentResult
+}
+
+// SetQuorum replaces the quorum rule used to combine local and agent probe results.
+func (e *Engine) SetQuorum(cfg config.QuorumConfig) {
+	e.agentMu.Lock()
+	defer e.agentMu.Unlock()
+	e.quorum = cfg
+}
+
+// ReportAgentResults records the latest probe results sent by a remote agent.
+func (e *Engine) ReportAgentResults(agent config.AgentConfig, results []AgentResult) {
+	e.agentMu.Lock()
+	defer e.agentMu.Unlock()
+
+	st := e.agents[agent.ID]
+	if st == nil {
+		st = &agentState{ID: agent.ID, Results: make(map[string]AgentResult)}
+		e.agents[agent.ID] = st
+	}
+	st.Name = agent.Name
+	st.Location = agent.Location
+	st.LastSeen = time.Now()
+	for _, r := range results {
+		// Agents report right after checking; the server's receive time keeps a skewed agent clock from
+		// making results look fresh forever (or stale immediately).
+		r.CheckedAt = st.LastSeen.UnixMilli()
+		st.Results[r.MonitorID] = r
+	}
+}
+
+// ForgetAgent drops everything known about an agent, e.g. after it has been deleted.
+func (e *Engine) ForgetAgent(id string) {
+	e.agentMu.Lock()
+	defer e.agentMu.Unlock()
+	delete(e.agents, id)
+}
+
+// applyQuorum combines the local probe result with fresh agent reports.
+// When quorum is enabled a target is only considered down once enough distinct locations agree. If fewer
+// locations than that report at all, no quorum is possible and the local result decides instead.
+func (e *Engine) applyQuorum(m *Monitor, localSuccess bool) bool {
+	enabled, failing, voters, minLocations := e.quorumVotes(m, localSuccess)
+	if !enabled {
+		return localSuccess
+	}
+	if voters < minLocations {
+		e.setQuorumUnavailable(m, true, voters, minLocations)
+		return localSuccess
+	}
+	e.setQuorumUnavailable(m, false, voters, minLocations)
+
+	if failing >= minLocations {
+		return false
+	}
+	if !localSuccess {
+		log.Printf("Monitor %s: local probe failed but only %d/%d locations agree, ignoring", m.Config.Name, failing, minLocations)
+	}
+	return true
+}
+
+// quorumVotes counts the distinct locations with a fresh result for m (voters) and those reporting a failure.
+func (e *Engine) quorumVotes(m *Monitor, localSuccess bool) (enabled bool, failing, voters, minLocations int) {
+	e.agentMu.RLock()
+	defer e.agentMu.RUnlock()
+
+	if !e.quorum.Enabled {
+		return false, 0, 0, 0
+	}
+	minLocations = e.quorum.MinLocations
+	if minLocations <= 0 {
+		minLocations = 2
+	}
+
+	votes := make(map[string]bool) // location -> failing
+	if e.quorum.IncludeLocal {
+		votes[localLocation] = !localSuccess
+	}
+
+	// Agent results older than a few intervals are stale and do not vote.
+	maxAge := time.Duration(intervalSeconds(m.Config)*3) * time.Second
+	now := time.Now()
+	for _, st := range e.agents {
+		r, ok := st.Results[m.Config.ID]
+		if !ok || now.Sub(time.UnixMilli(r.CheckedAt)) > maxAge {
+			continue
+		}
+		loc := agentLocation(st)
+		votes[loc] = votes[loc] || !r.Success
+	}
+
+	for _, down := range votes {
+		if down {
+			failing++
+		}
+	}
+	return true, failing, len(votes), minLocations
+}
+
+// setQuorumUnavailable records whether m lacks enough voters for a quorum and reports transitions.
+func (e *Engine) setQuorumUnavailable(m *Monitor, unavailable bool, voters, required int) {
+	m.mu.Lock()
+	changed := m.QuorumUnavailable != unavailable
+	m.QuorumUnavailable = unavailable
+	m.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	if unavailable {
+		log.Printf("Monitor %s: only %d/%d locations report, falling back to the local probe", m.Config.Name, voters, required)
+	} else {
+		log.Printf("Monitor %s: quorum available again (%d locations)", m.Config.Name, voters)
+	}
+	if e.OnQuorumUnavailable != nil {
+		e.goCallback("quorum unavailable", func() { e.OnQuorumUnavailable(m.ctx, m, unavailable, voters, required) })
+	}
+}
+
+// AgentStatus returns the health of every agent that has reported at least once.
+func (e *Engine) AgentStatus() []map[string]interface{} {
+	e.agentMu.RLock()
+	defer e.agentMu.RUnlock()
+
+	now := time.Now()
+	res := make([]map[string]interface{}, 0, len(e.agents))
+	for _, st := range e.agents {
+		failing := 0
+		for _, r := range st.Results {
+			if !r.Success {
+				failing++
+			}
+		}
+		res = append(res, map[string]interface{}{
+			"id":        st.ID,
+			"name":      st.Name,
+			"location":  agentLocation(st),
+			"last_seen": st.LastSeen.UnixMilli(),
+			"online":    now.Sub(st.LastSeen) < 2*time.Minute,
+			"monitors":  len(st.Results),
+			"failing":   failing,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i]["id"].(string) < res[j]["id"].(string)
+	})
+	return res
+}
+
+func agentLocation(st *agentState) string {
+	if st.Location != "" {
+		return st.Location
+	}
+	return st.ID
+}
+
+func intervalSeconds(cfg config.MonitorConfig) int {
+	if cfg.Interval <= 0 {
+		return 60
+	}
+	return cfg.Interval
+}
@@ -0,0 +1,139 @@
+package monitor
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"dns-failover/internal/config"
+)
+
+// Restore policies for MonitorConfig.RestorePolicy.
+const (
+	RestoreAuto              = "auto"
+	RestoreManual            = "manual"
+	RestoreAutoAfterApproval = "auto-after-approval"
+)
+
+func restorePolicy(cfg config.MonitorConfig) string {
+	switch cfg.RestorePolicy {
+	case RestoreManual, RestoreAutoAfterApproval:
+		return cfg.RestorePolicy
+	default:
+		return RestoreAuto
+	}
+}
+
+// restoreOrWait is called once the original IP is known to be healthy while failed over: it passed
+// SuccessThreshold checks, or an external alert resolved. Depending on the restore policy it switches back
+// (with reason) or keeps probing and waits for an operator. Callers hold m.mu.
+func (e *Engine) restoreOrWait(m *Monitor, reason string) {
+	policy := restorePolicy(m.Config)
+	if policy == RestoreAuto || (policy == RestoreAutoAfterApproval && m.RestoreApproved) {
+		e.restoreLocked(m, reason)
+		return
+	}
+
+	m.SuccCount = 0
+	if m.OriginalHealthy {
+		return
+	}
+	m.OriginalHealthy = true
+	log.Printf("Monitor %s: original IP healthy, waiting for %s restore", m.Config.Name, policy)
+	if e.OnOriginalRecovered != nil {
+		e.goCallback("original recovered", func() { e.OnOriginalRecovered(m.ctx, m) })
+	}
+}
+
+// restoreLocked switches a failed-over monitor back to its original IP. Callers hold m.mu.
+func (e *Engine) restoreLocked(m *Monitor, reason string) {
+	m.Status = StatusNormal
+	m.CurrentIP = m.Config.OriginalIP
+	m.SuccCount = 0
+	m.OriginalHealthy = false
+	m.RestoreApproved = false
+	m.StableSince = time.Time{}
+	m.StableFailures = 0
+	e.saveState(m)
+	e.fireSwitch(m, false, reason)
+}
+
+// markFailedOver moves a monitor onto its backup IP and starts the minimum hold time. Callers hold m.mu.
+func markFailedOver(m *Monitor) {
+	m.Status = StatusDown
+	m.CurrentIP = m.Config.BackupIP
+	m.SwitchedAt = time.Now()
+	m.StableSince = time.Time{}
+	m.StableFailures = 0
+}
+
+// noteStabilizationFailure counts a failed check inside the stabilization window and restarts the window
+// once more than StabilizationMaxFailures failures were seen. Callers hold m.mu.
+func noteStabilizationFailure(m *Monitor) {
+	if m.StableSince.IsZero() {
+		return
+	}
+	m.StableFailures++
+	if m.StableFailures > m.Config.StabilizationMaxFailures {
+		m.StableSince = time.Time{}
+		m.StableFailures = 0
+	}
+}
+
+// restoreWindowElapsed reports whether both the minimum hold time and the stabilization window have passed.
+func restoreWindowElapsed(m *Monitor, now time.Time) bool {
+	hold, stabilization := restoreCountdown(m, now)
+	return hold == 0 && stabilization == 0
+}
+
+// restoreCountdown returns the seconds left before the hold time and the stabilization window are over.
+func restoreCountdown(m *Monitor, now time.Time) (hold, stabilization int) {
+	if m.Config.MinHoldSeconds > 0 && !m.SwitchedAt.IsZero() {
+		end := m.SwitchedAt.Add(time.Duration(m.Config.MinHoldSeconds) * time.Second)
+		hold = secondsUntil(now, end)
+	}
+	if m.Config.StabilizationSeconds > 0 {
+		if m.StableSince.IsZero() {
+			stabilization = m.Config.StabilizationSeconds
+		} else {
+			end := m.StableSince.Add(time.Duration(m.Config.StabilizationSeconds) * time.Second)
+			stabilization = secondsUntil(now, end)
+		}
+	}
+	return hold, stabilization
+}
+
+func secondsUntil(now, end time.Time) int {
+	if !end.After(now) {
+		return 0
+	}
+	return int(end.Sub(now).Round(time.Second) / time.Second)
+}
+
+// ApproveRestore approves switching back for an "auto-after-approval" monitor. The restore happens now if
+// the original IP is already healthy, otherwise as soon as it passes its checks.
+func (e *Engine) ApproveRestore(id string) (restored bool, err error) {
+	e.mu.RLock()
+	m := e.Monitors[id]
+	e.mu.RUnlock()
+	if m == nil {
+		return false, fmt.Errorf("monitor %s not found", id)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if restorePolicy(m.Config) != RestoreAutoAfterApproval {
+		return false, fmt.Errorf("monitor %s does not use the %s restore policy", m.Config.Name, RestoreAutoAfterApproval)
+	}
+	if m.Status != StatusDown {
+		return false, fmt.Errorf("monitor %s is not failed over", m.Config.Name)
+	}
+	if m.OriginalHealthy {
+		e.restoreLocked(m, "restore")
+		return true, nil
+	}
+	m.RestoreApproved = true
+	e.saveState(m)
+	return false, nil
+}
@@ -0,0 +1,365 @@
+package monitor
+
+import (
+	"container/heap"
+	"context"
+	"hash/fnv"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"dns-failover/internal/config"
+)
+
+type jobKind int
+
+const (
+	jobCheck    jobKind = iota // health check for a monitor
+	jobSchedule                // scheduled (non-failover) switch
+)
+
+// job is a single scheduled run. Each monitor has at most one job of each kind in the system: a job
+// is re-queued only after it has finished, so a slow check can never pile up behind itself.
+type job struct {
+	due   time.Time
+	kind  jobKind
+	m     *Monitor
+	index int
+}
+
+type jobQueue []*job
+
+func (q jobQueue) Len() int           { return len(q) }
+func (q jobQueue) Less(i, j int) bool { return q[i].due.Before(q[j].due) }
+func (q jobQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+func (q *jobQueue) Push(x interface{}) {
+	j := x.(*job)
+	j.index = len(*q)
+	*q = append(*q, j)
+}
+func (q *jobQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	j := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return j
+}
+
+type schedulerStats struct {
+	running      int
+	dispatched   int64
+	overruns     int64
+	sharedProbes int64
+	lastLag      time.Duration
+	windowStart  time.Time
+	windowMaxLag time.Duration
+	prevMaxLag   time.Duration
+}
+
+// SetScheduler configures the worker pool. It must be called before Start.
+func (e *Engine) SetScheduler(cfg config.SchedulerConfig) {
+	e.schedMu.Lock()
+	defer e.schedMu.Unlock()
+	e.scheduler = cfg
+	e.typeLimit = make(map[string]int)
+	e.typeRunning = make(map[string]int)
+	e.typeWaiting = make(map[string][]*job)
+	for checkType, limit := range cfg.TypeLimits {
+		if limit > 0 {
+			e.typeLimit[checkType] = limit
+		}
+	}
+}
+
+// Start runs the dispatcher and the worker pool until ctx is done.
+func (e *Engine) Start(ctx context.Context) {
+	e.schedMu.Lock()
+	workers := e.scheduler.Workers
+	e.baseCtx = ctx
+	e.schedMu.Unlock()
+	if workers <= 0 {
+		workers = 32
+	}
+
+	e.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go e.worker(ctx)
+	}
+	go e.dispatch(ctx)
+}
+
+func (e *Engine) schedule(j *job) {
+	e.schedMu.Lock()
+	heap.Push(&e.queue, j)
+	e.schedMu.Unlock()
+
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch hands due jobs to the workers in due order. When all workers are busy it blocks, so the
+// backlog shows up as queue depth and check lag instead of piling up goroutines. A check whose type is
+// at its concurrency limit is parked until a check of that type finishes, without taking a worker.
+func (e *Engine) dispatch(ctx context.Context) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		e.schedMu.Lock()
+		var wait time.Duration = time.Hour
+		var next *job
+		if len(e.queue) > 0 {
+			if d := time.Until(e.queue[0].due); d > 0 {
+				wait = d
+			} else {
+				next = heap.Pop(&e.queue).(*job)
+				if !e.acquireTypeLocked(next) {
+					e.typeWaiting[next.m.Config.CheckType] = append(e.typeWaiting[next.m.Config.CheckType], next)
+					e.schedMu.Unlock()
+					continue
+				}
+			}
+		}
+		e.schedMu.Unlock()
+
+		if next == nil {
+			timer.Reset(wait)
+			select {
+			case <-ctx.Done():
+				return
+			case <-e.wake:
+			case <-timer.C:
+			}
+			continue
+		}
+
+		if next.m.ctx.Err() != nil || !e.isCurrent(next.m) {
+			e.releaseType(next)
+			continue
+		}
+		e.recordLag(time.Since(next.due))
+
+		select {
+		case <-ctx.Done():
+			return
+		case e.work <- next:
+		}
+	}
+}
+
+// acquireTypeLocked takes a slot for a check of a limited type, reporting false when none is free.
+// Callers hold schedMu.
+func (e *Engine) acquireTypeLocked(j *job) bool {
+	if j.kind != jobCheck {
+		return true
+	}
+	checkType := j.m.Config.CheckType
+	limit := e.typeLimit[checkType]
+	if limit == 0 {
+		return true
+	}
+	if e.typeRunning[checkType] >= limit {
+		return false
+	}
+	e.typeRunning[checkType]++
+	return true
+}
+
+// releaseType frees the slot taken by acquireTypeLocked and requeues the longest waiting check of the
+// same type, which keeps its original due time and is dispatched next.
+func (e *Engine) releaseType(j *job) {
+	if j.kind != jobCheck {
+		return
+	}
+	checkType := j.m.Config.CheckType
+	e.schedMu.Lock()
+	if e.typeLimit[checkType] == 0 {
+		e.schedMu.Unlock()
+		return
+	}
+	e.typeRunning[checkType]--
+	waiting := e.typeWaiting[checkType]
+	if len(waiting) == 0 {
+		e.schedMu.Unlock()
+		return
+	}
+	next := waiting[0]
+	waiting[0] = nil
+	e.typeWaiting[checkType] = waiting[1:]
+	e.schedMu.Unlock()
+
+	e.schedule(next)
+}
+
+// releaseTypeWhenDone calls releaseType once probeDone is closed; a nil probeDone releases right away.
+func (e *Engine) releaseTypeWhenDone(j *job, probeDone <-chan struct{}) {
+	if probeDone != nil {
+		select {
+		case <-probeDone:
+		default:
+			go func() {
+				<-probeDone
+				e.releaseType(j)
+			}()
+			return
+		}
+	}
+	e.releaseType(j)
+}
+
+func (e *Engine) worker(ctx context.Context) {
+	defer e.workers.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-e.work:
+			e.runJob(ctx, j)
+		}
+	}
+}
+
+func (e *Engine) runJob(ctx context.Context, j *job) {
+	e.schedMu.Lock()
+	e.stats.running++
+	e.schedMu.Unlock()
+
+	defer func() {
+		e.schedMu.Lock()
+		e.stats.running--
+		e.schedMu.Unlock()
+	}()
+
+	var delay time.Duration
+	switch j.kind {
+	case jobSchedule:
+		e.scheduledSwitch(j.m)
+		delay = time.Duration(j.m.Config.ScheduleHours) * time.Hour
+	default:
+		// The dispatcher took the check type's slot (see acquireTypeLocked), e.g. to cap concurrent ICMP
+		// probes. It is held until the probe has finished, even if a stopped monitor no longer waits for it.
+		e.releaseTypeWhenDone(j, e.check(j.m))
+		delay = nextCheckDelay(j.m)
+	}
+
+	if j.m.ctx.Err() != nil || !e.isCurrent(j.m) {
+		return
+	}
+
+	// Keep a fixed rate relative to the due time; if the run took longer than the interval, the check
+	// overran and the next one starts immediately instead of queueing several.
+	next := j.due.Add(delay)
+	if now := time.Now(); next.Before(now) {
+		e.schedMu.Lock()
+		e.stats.overruns++
+		e.schedMu.Unlock()
+		log.Printf("Monitor %s: check overran its interval by %v", j.m.Config.Name, now.Sub(next).Round(time.Millisecond))
+		next = now
+	}
+	e.schedule(&job{due: next, kind: j.kind, m: j.m})
+}
+
+// nextCheckDelay returns the time until the next check: the suspect interval while a monitor is
+// accumulating failures, the normal interval otherwise, with ±10% jitter.
+func nextCheckDelay(m *Monitor) time.Duration {
+	m.mu.RLock()
+	suspect := m.Status == StatusNormal && m.FailCount > 0
+	m.mu.RUnlock()
+
+	seconds := intervalSeconds(m.Config)
+	if suspect && m.Config.SuspectInterval > 0 && m.Config.SuspectInterval < seconds {
+		seconds = m.Config.SuspectInterval
+	}
+	d := time.Duration(seconds) * time.Second
+	return d - d/10 + time.Duration(rand.Int64N(int64(d/5)+1))
+}
+
+// checkPhase spreads first checks over a whole interval so monitors don't probe in lockstep. The offset
+// is derived from the probe key, so monitors probing the same endpoint start aligned and share results;
+// later runs are jittered by nextCheckDelay.
+func checkPhase(cfg config.MonitorConfig) time.Duration {
+	h := fnv.New64a()
+	h.Write([]byte(probeKey(cfg)))
+	interval := time.Duration(intervalSeconds(cfg)) * time.Second
+	return time.Duration(h.Sum64() % uint64(interval))
+}
+
+// baseContext returns the context passed to Start, for work not owned by a single monitor.
+func (e *Engine) baseContext() context.Context {
+	e.schedMu.Lock()
+	defer e.schedMu.Unlock()
+	if e.baseCtx == nil {
+		return context.Background()
+	}
+	return e.baseCtx
+}
+
+// isCurrent reports whether m is still the registered monitor for its ID (not stopped or replaced).
+func (e *Engine) isCurrent(m *Monitor) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.Monitors[m.Config.ID] == m
+}
+
+func (e *Engine) recordLag(lag time.Duration) {
+	e.schedMu.Lock()
+	defer e.schedMu.Unlock()
+
+	now := time.Now()
+	if now.Sub(e.stats.windowStart) >= time.Minute {
+		e.stats.prevMaxLag = e.stats.windowMaxLag
+		e.stats.windowMaxLag = 0
+		e.stats.windowStart = now
+	}
+	e.stats.dispatched++
+	e.stats.lastLag = lag
+	if lag > e.stats.windowMaxLag {
+		e.stats.windowMaxLag = lag
+	}
+}
+
+// SchedulerStatus returns queue depth, worker usage and check lag for status output.
+func (e *Engine) SchedulerStatus() map[string]interface{} {
+	e.schedMu.Lock()
+	defer e.schedMu.Unlock()
+
+	now := time.Now()
+	depth := 0
+	for _, j := range e.queue {
+		if !j.due.After(now) {
+			depth++
+		}
+	}
+	waiting := 0
+	for _, jobs := range e.typeWaiting {
+		waiting += len(jobs)
+	}
+	maxLag := e.stats.windowMaxLag
+	if e.stats.prevMaxLag > maxLag {
+		maxLag = e.stats.prevMaxLag
+	}
+	workers := e.scheduler.Workers
+	if workers <= 0 {
+		workers = 32
+	}
+
+	return map[string]interface{}{
+		"workers":     workers,
+		"busy":        e.stats.running,
+		"scheduled":   len(e.queue) + waiting,
+		"queue_depth": depth + waiting,
+		"lag_ms":      e.stats.lastLag.Milliseconds(),
+		"max_lag_ms":  maxLag.Milliseconds(),
+		"dispatched":  e.stats.dispatched,
+		"overruns":    e.stats.overruns,
+		// Checks answered by a probe shared with another monitor (see sharedProbe).
+		"shared_probes": e.stats.sharedProbes,
+	}
+}
@@ -0,0 +1,135 @@
+package monitor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"dns-failover/internal/config"
+)
+
+// addTestMonitor registers a monitor without StartMonitor's phased first check and queues a check due now.
+func addTestMonitor(ctx context.Context, e *Engine, cfg config.MonitorConfig) {
+	mCtx, cancel := context.WithCancel(ctx)
+	m := &Monitor{Config: cfg, Status: StatusNormal, CurrentIP: cfg.OriginalIP, ctx: mCtx}
+	e.mu.Lock()
+	e.Monitors[cfg.ID] = m
+	e.cancels[cfg.ID] = cancel
+	e.mu.Unlock()
+	e.schedule(&job{due: time.Now(), kind: jobCheck, m: m})
+}
+
+func testMonitor(id, checkType string) config.MonitorConfig {
+	return config.MonitorConfig{
+		ID: id, Name: id, CheckType: checkType, CheckTarget: id,
+		Interval: 3600, FailureThreshold: 3, SuccessThreshold: 1, TimeoutSeconds: 10,
+	}
+}
+
+// fakeProbes stands in for the engine's probe. Every probe reports its target on started; http probes
+// then block until release is closed, ignoring their context like a probe stuck in a slow syscall.
+type fakeProbes struct {
+	started chan string
+	release chan struct{}
+
+	mu          sync.Mutex
+	httpRunning int
+	httpPeak    int
+}
+
+func newFakeProbes(e *Engine) *fakeProbes {
+	f := &fakeProbes{started: make(chan string, 16), release: make(chan struct{})}
+	e.probe = f.probe
+	return f
+}
+
+func (f *fakeProbes) probe(_ context.Context, cfg config.MonitorConfig) bool {
+	if cfg.CheckType != "http" {
+		f.started <- cfg.CheckTarget
+		return true
+	}
+	f.mu.Lock()
+	f.httpRunning++
+	f.httpPeak = max(f.httpPeak, f.httpRunning)
+	f.mu.Unlock()
+	f.started <- cfg.CheckTarget
+	<-f.release
+	f.mu.Lock()
+	f.httpRunning--
+	f.mu.Unlock()
+	return true
+}
+
+func (f *fakeProbes) peak() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.httpPeak
+}
+
+func (f *fakeProbes) expect(t *testing.T, target string) {
+	t.Helper()
+	select {
+	case got := <-f.started:
+		if got != target {
+			t.Fatalf("probe of %s started, want %s", got, target)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("probe of %s never started", target)
+	}
+}
+
+func TestTypeLimitDoesNotBlockOtherTypes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := NewEngine()
+	probes := newFakeProbes(e)
+	e.SetScheduler(config.SchedulerConfig{Workers: 2, TypeLimits: map[string]int{"http": 1}})
+	e.Start(ctx)
+
+	addTestMonitor(ctx, e, testMonitor("a", "http"))
+	probes.expect(t, "a")
+	// The second http check is due before the tcping check, so it has been parked by the time the tcping
+	// check runs. Parked, it does not hold the second worker.
+	addTestMonitor(ctx, e, testMonitor("b", "http"))
+	addTestMonitor(ctx, e, testMonitor("c", "tcping"))
+	probes.expect(t, "c")
+	if got := e.SchedulerStatus()["queue_depth"]; got != 1 {
+		t.Errorf("queue_depth = %v, want 1 (the parked http check)", got)
+	}
+
+	close(probes.release)
+	probes.expect(t, "b")
+	if got := probes.peak(); got != 1 {
+		t.Errorf("max concurrent http probes = %d, want 1", got)
+	}
+}
+
+func TestTypeSlotHeldUntilProbeFinishes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := NewEngine()
+	probes := newFakeProbes(e)
+	// A single worker: the tcping check below can only run once the stopped monitor's job has returned.
+	e.SetScheduler(config.SchedulerConfig{Workers: 1, TypeLimits: map[string]int{"http": 1}})
+	e.Start(ctx)
+
+	addTestMonitor(ctx, e, testMonitor("a", "http"))
+	probes.expect(t, "a")
+	// Stopping a ends its check, but its probe is still running and keeps the http slot.
+	e.StopMonitor("a")
+	addTestMonitor(ctx, e, testMonitor("b", "http"))
+	addTestMonitor(ctx, e, testMonitor("c", "tcping"))
+	probes.expect(t, "c")
+	if got := e.SchedulerStatus()["queue_depth"]; got != 1 {
+		t.Errorf("queue_depth = %v, want 1 (b waiting for the slot of a's probe)", got)
+	}
+
+	close(probes.release)
+	probes.expect(t, "b")
+	if got := probes.peak(); got != 1 {
+		t.Errorf("max concurrent http probes = %d, want 1", got)
+	}
+}
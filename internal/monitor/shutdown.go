@@ -0,0 +1,48 @@
+package monitor
+
+import (
+	"context"
+	"log"
+)
+
+// goCallback runs a callback in its own goroutine and tracks it, so Shutdown can wait for DNS updates
+// and notifications that are still in flight. Callbacks fired after the drain has started are dropped.
+func (e *Engine) goCallback(name string, f func()) {
+	e.cbMu.Lock()
+	if e.cbClosed {
+		e.cbMu.Unlock()
+		log.Printf("Engine shutting down, dropping %s callback", name)
+		return
+	}
+	e.callbacks.Add(1)
+	e.cbMu.Unlock()
+
+	go func() {
+		defer e.callbacks.Done()
+		f()
+	}()
+}
+
+// Shutdown drains the engine once the context passed to Start is done: it waits for the workers to
+// finish their current checks and then for every callback still in flight. Monitor contexts are not
+// cancelled here, so pending DNS updates run to completion; the caller cancels them afterwards.
+// It returns ctx.Err() if the deadline passes first.
+func (e *Engine) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		e.workers.Wait()
+
+		e.cbMu.Lock()
+		e.cbClosed = true
+		e.cbMu.Unlock()
+		e.callbacks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,284 @@
+// Package outbox applies the DNS side of switches durably. Every switch is queued in the store before
+// it is applied and only removed once the provider accepted it, so an update that fails because the API
+// is down or rate limited is retried with backoff, across restarts, until it lands or is superseded.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"dns-failover/internal/config"
+	"dns-failover/internal/service"
+)
+
+const (
+	baseBackoff       = 5 * time.Second
+	defaultMaxBackoff = 5 * time.Minute
+	defaultAlertAfter = 5 * time.Minute
+)
+
+type Outbox struct {
+	store *config.Store
+
+	// OnApplied runs after an entry's update was accepted, with the per-record results.
+	OnApplied func(ctx context.Context, e config.OutboxEntry, m config.MonitorConfig, results []service.RecordResult)
+
+	wake    chan struct{}
+	stop    chan struct{}
+	workers sync.WaitGroup
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex // per monitor, so updates for one monitor never overlap or reorder
+}
+
+func New(store *config.Store) *Outbox {
+	return &Outbox{
+		store: store,
+		wake:  make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+		locks: make(map[string]*sync.Mutex),
+	}
+}
+
+// Enqueue queues a switch of monitor m to ip and wakes the dispatcher. It replaces whatever update is
+// still pending for m.
+func (o *Outbox) Enqueue(m config.MonitorConfig, ip string, proxied bool, reason string) error {
+	if err := o.store.PutOutboxEntry(newEntry(m, ip, proxied, reason)); err != nil {
+		return err
+	}
+	o.kick()
+	return nil
+}
+
+// EnqueueIfIdle is Enqueue for corrections: it never replaces an update already pending for m, as that
+// one is newer than whatever state the caller based its decision on.
+func (o *Outbox) EnqueueIfIdle(m config.MonitorConfig, ip string, proxied bool, reason string) (bool, error) {
+	added, err := o.store.AddOutboxEntry(newEntry(m, ip, proxied, reason))
+	if added {
+		o.kick()
+	}
+	return added, err
+}
+
+// ApplyNow queues a switch and applies it right away, for callers that want the result (a manual
+// restore). When the attempt fails the entry stays queued and is retried like any other.
+func (o *Outbox) ApplyNow(ctx context.Context, m config.MonitorConfig, ip string, proxied bool, reason string) ([]service.RecordResult, error) {
+	// Lock first so the dispatcher cannot pick the entry up in between.
+	lock := o.lock(m.ID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	e := newEntry(m, ip, proxied, reason)
+	if err := o.store.PutOutboxEntry(e); err != nil {
+		return nil, err
+	}
+	return o.attempt(ctx, e)
+}
+
+// Discard drops a pending update.
+func (o *Outbox) Discard(id string) error {
+	return o.store.DeleteOutboxEntry(id)
+}
+
+// Run dispatches due entries until ctx is cancelled or Shutdown is called.
+func (o *Outbox) Run(ctx context.Context) {
+	var wait time.Duration
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.stop:
+			return
+		case <-time.After(wait):
+		case <-o.wake:
+		}
+		wait = o.dispatch(ctx)
+	}
+}
+
+// Shutdown stops dispatching and waits for attempts in flight. Entries left pending are retried after
+// the next start.
+func (o *Outbox) Shutdown(ctx context.Context) error {
+	close(o.stop)
+	done := make(chan struct{})
+	go func() {
+		o.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// dispatch starts an attempt for every due entry whose monitor is idle, raises deadline alerts, and
+// returns how long until the next entry is due.
+func (o *Outbox) dispatch(ctx context.Context) time.Duration {
+	cfg := o.store.GetDNSRetryConfig()
+	alertAfter := service.Seconds(cfg.AlertAfterSeconds, defaultAlertAfter)
+
+	now := time.Now()
+	next := defaultMaxBackoff
+	for _, e := range o.store.ListOutbox() {
+		lock := o.lock(e.MonitorID)
+		if !lock.TryLock() {
+			continue // an attempt is running; it wakes the dispatcher when done
+		}
+
+		if deadline := time.UnixMilli(e.CreatedAt).Add(alertAfter); !e.Alerted {
+			if !now.Before(deadline) {
+				o.alert(e)
+			} else if d := deadline.Sub(now); d < next {
+				next = d
+			}
+		}
+
+		due := time.UnixMilli(e.NextAttempt)
+		if due.After(now) {
+			lock.Unlock()
+			if d := due.Sub(now); d < next {
+				next = d
+			}
+			continue
+		}
+
+		o.workers.Add(1)
+		go func(id string) {
+			defer o.workers.Done()
+			defer o.kick()
+			defer lock.Unlock()
+			// Re-read under the lock: the entry may have been applied or replaced meanwhile.
+			if current, ok := o.store.GetOutboxEntry(e.MonitorID); ok && current.ID == id {
+				o.attempt(ctx, current)
+			}
+		}(e.ID)
+	}
+	return next
+}
+
+// attempt applies e once. The caller holds the monitor's lock.
+func (o *Outbox) attempt(ctx context.Context, e config.OutboxEntry) ([]service.RecordResult, error) {
+	m, ok := o.store.GetMonitor(e.MonitorID)
+	if !ok {
+		_ = o.store.DeleteOutboxEntry(e.ID)
+		return nil, fmt.Errorf("monitor %s no longer exists", e.MonitorID)
+	}
+	if m.Revision != e.Revision {
+		// The monitor was edited after the switch was decided: its IPs or records may have changed.
+		_ = o.store.DeleteOutboxEntry(e.ID)
+		log.Printf("Dropping DNS update for %s to %s: monitor config changed since it was queued", e.Name, e.IP)
+		return nil, fmt.Errorf("monitor %s was changed after the update was queued", e.Name)
+	}
+
+	results, err := service.ApplySwitch(ctx, o.store, m, e.IP, e.Proxied)
+	logResults(results)
+	if err == nil {
+		_ = o.store.DeleteOutboxEntry(e.ID)
+		applied := config.AppliedTarget{IP: e.IP, Proxied: e.Proxied, Revision: m.Revision, AppliedAt: time.Now().UnixMilli()}
+		if err := o.store.PutAppliedTarget(m.ID, applied); err != nil {
+			log.Printf("Failed to save applied DNS target for %s: %v", e.Name, err)
+		}
+		if e.Attempts > 0 {
+			log.Printf("DNS update for %s applied after %d retries", e.Name, e.Attempts)
+		}
+		if e.Alerted {
+			o.notify(fmt.Sprintf("DNS 更新已生效：%s 已切换到 %s（重试 %d 次）", e.Name, e.IP, e.Attempts))
+		}
+		if o.OnApplied != nil {
+			o.OnApplied(ctx, e, m, results)
+		}
+		return results, nil
+	}
+	if ctx.Err() != nil {
+		// Shutting down: leave the entry as it is for the next start.
+		return results, err
+	}
+
+	e.Attempts++
+	e.LastError = err.Error()
+	delay := backoff(e.Attempts, service.Seconds(o.store.GetDNSRetryConfig().MaxBackoffSeconds, defaultMaxBackoff))
+	if wait, limited := service.RetryAfter(err); limited && wait > delay {
+		delay = wait
+	}
+	e.NextAttempt = time.Now().Add(delay).UnixMilli()
+	if _, saveErr := o.store.UpdateOutboxEntry(e); saveErr != nil {
+		log.Printf("Failed to persist DNS retry state: %v", saveErr)
+	}
+	log.Printf("DNS update for %s to %s failed (attempt %d), retrying in %s: %v", e.Name, e.IP, e.Attempts, delay, err)
+	return results, err
+}
+
+func (o *Outbox) alert(e config.OutboxEntry) {
+	e.Alerted = true
+	if ok, _ := o.store.UpdateOutboxEntry(e); !ok {
+		return
+	}
+	pending := time.Since(time.UnixMilli(e.CreatedAt)).Round(time.Second)
+	msg := fmt.Sprintf("DNS 更新未生效：%s 切换到 %s 已等待 %s，重试 %d 次，最近错误：%s", e.Name, e.IP, pending, e.Attempts, e.LastError)
+	o.notify(msg)
+}
+
+func (o *Outbox) notify(msg string) {
+	log.Println(msg)
+	service.NewNotificationService(o.store.GetDingTalkConfig(), o.store.GetEmailConfig(), o.store.GetTelegramConfig()).Notify(msg)
+}
+
+func (o *Outbox) kick() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox) lock(monitorID string) *sync.Mutex {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	l, ok := o.locks[monitorID]
+	if !ok {
+		l = new(sync.Mutex)
+		o.locks[monitorID] = l
+	}
+	return l
+}
+
+func newEntry(m config.MonitorConfig, ip string, proxied bool, reason string) config.OutboxEntry {
+	now := time.Now().UnixMilli()
+	return config.OutboxEntry{
+		ID:          fmt.Sprintf("%d", time.Now().UnixNano()),
+		MonitorID:   m.ID,
+		Name:        m.Name,
+		IP:          ip,
+		Proxied:     proxied,
+		Reason:      reason,
+		Revision:    m.Revision,
+		CreatedAt:   now,
+		NextAttempt: now,
+	}
+}
+
+// backoff doubles from baseBackoff with every failed attempt, up to max.
+func backoff(attempts int, max time.Duration) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempts && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+func logResults(results []service.RecordResult) {
+	for _, r := range results {
+		if r.Error != "" {
+			log.Printf("DNS %s %s (%s): %s: %s", r.Type, r.Name, r.ID, r.Status, r.Error)
+		} else {
+			log.Printf("DNS %s %s (%s): %s -> %s", r.Type, r.Name, r.ID, r.Status, r.Content)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Package propagation confirms that an applied switch is actually being served: after the provider
+// accepted an update, the switched records are looked up on public resolvers until every resolver
+// answers with the new target, or a timeout is reached and an alert is sent.
+package propagation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"dns-failover/internal/config"
+	"dns-failover/internal/service"
+
+	"github.com/miekg/dns"
+)
+
+// Results stored in config.SwitchEvent.Propagation.
+const (
+	Verified = "verified"
+	TimedOut = "timeout"
+)
+
+const (
+	defaultTimeout  = 5 * time.Minute
+	defaultInterval = 10 * time.Second
+	queryTimeout    = 5 * time.Second
+)
+
+var defaultResolvers = []string{"1.1.1.1:53", "8.8.8.8:53", "9.9.9.9:53"}
+
+// ResolverAddr normalizes a configured resolver ("ip" or "ip:port") to an address for dns.Client.
+func ResolverAddr(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if ip := net.ParseIP(s); ip != nil {
+		return net.JoinHostPort(ip.String(), "53"), nil
+	}
+	host, port, err := net.SplitHostPort(s)
+	if err != nil || net.ParseIP(host) == nil || port == "" {
+		return "", fmt.Errorf("invalid resolver %q, expected ip or ip:port", s)
+	}
+	return s, nil
+}
+
+type Verifier struct {
+	ctx   context.Context
+	store *config.Store
+
+	mu      sync.Mutex
+	running map[string]*run // per monitor; a newer switch cancels the older check
+}
+
+type run struct {
+	cancel context.CancelFunc
+}
+
+// New returns a Verifier whose checks stop when ctx is cancelled.
+func New(ctx context.Context, store *config.Store) *Verifier {
+	return &Verifier{ctx: ctx, store: store, running: make(map[string]*run)}
+}
+
+// check is one record to confirm on one resolver, or through the provider's API when resolver is empty.
+type check struct {
+	name, typ, resolver string
+}
+
+func (c check) String() string {
+	if c.resolver == "" {
+		return fmt.Sprintf("%s %s (API)", c.name, c.typ)
+	}
+	return fmt.Sprintf("%s %s @%s", c.name, c.typ, c.resolver)
+}
+
+// Start verifies the records of an applied outbox entry in the background. Drift corrections and
+// load balancer switches, which change no records, are not verified.
+func (v *Verifier) Start(e config.OutboxEntry, m config.MonitorConfig, results []service.RecordResult) {
+	cfg := v.store.GetPropagationConfig()
+	if !cfg.Enabled || e.Reason == "drift" {
+		return
+	}
+
+	p, err := service.ProviderForMonitor(v.store, m)
+	if err != nil {
+		log.Printf("Propagation check for %s skipped: %v", m.Name, err)
+		return
+	}
+	_, viaAPI := p.(*service.CloudflareProvider)
+	viaAPI = viaAPI && e.Proxied
+
+	resolvers := make([]string, 0, len(cfg.Resolvers))
+	for _, r := range cfg.Resolvers {
+		addr, err := ResolverAddr(r)
+		if err != nil {
+			log.Printf("Propagation check: %v", err)
+			continue
+		}
+		resolvers = append(resolvers, addr)
+	}
+	if len(resolvers) == 0 {
+		resolvers = defaultResolvers
+	}
+
+	var checks []check
+	seen := make(map[string]bool)
+	for _, r := range results {
+		key := strings.ToLower(r.Name) + " " + r.Type
+		if r.Status == service.RecordFailed || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if viaAPI && service.Proxiable(r.Type) {
+			checks = append(checks, check{name: r.Name, typ: r.Type})
+			continue
+		}
+		for _, addr := range resolvers {
+			checks = append(checks, check{name: r.Name, typ: r.Type, resolver: addr})
+		}
+	}
+	if len(checks) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(v.ctx)
+	self := &run{cancel: cancel}
+	v.mu.Lock()
+	if prev, ok := v.running[m.ID]; ok {
+		prev.cancel()
+	}
+	v.running[m.ID] = self
+	v.mu.Unlock()
+
+	go func() {
+		defer func() {
+			v.mu.Lock()
+			if v.running[m.ID] == self {
+				delete(v.running, m.ID)
+			}
+			v.mu.Unlock()
+			cancel()
+		}()
+		v.verify(ctx, p, e, m, checks, cfg)
+	}()
+}
+
+func (v *Verifier) verify(ctx context.Context, p service.DNSProvider, e config.OutboxEntry, m config.MonitorConfig, pending []check, cfg config.PropagationConfig) {
+	timeout := service.Seconds(cfg.TimeoutSeconds, defaultTimeout)
+	interval := service.Seconds(cfg.IntervalSeconds, defaultInterval)
+	start := time.Now()
+
+	for {
+		remaining := pending[:0]
+		for _, c := range pending {
+			if ctx.Err() != nil {
+				return
+			}
+			ok, err := v.observed(ctx, p, m, c, e.IP)
+			if err != nil {
+				log.Printf("Propagation check %s: %v", c, err)
+			}
+			if !ok {
+				remaining = append(remaining, c)
+			}
+		}
+		pending = remaining
+		elapsed := time.Since(start)
+
+		if len(pending) == 0 {
+			log.Printf("DNS switch of %s to %s propagated in %s", m.Name, e.IP, elapsed.Round(time.Millisecond))
+			v.record(m.ID, e.IP, Verified, elapsed)
+			return
+		}
+		if elapsed >= timeout {
+			names := make([]string, 0, len(pending))
+			for _, c := range pending {
+				names = append(names, c.String())
+			}
+			v.record(m.ID, e.IP, TimedOut, elapsed)
+			v.notify(fmt.Sprintf("DNS 传播超时：%s 切换到 %s 已 %s，以下解析仍未返回新地址：%s",
+				m.Name, e.IP, elapsed.Round(time.Second), strings.Join(names, "、")))
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// observed reports whether c already answers with target.
+func (v *Verifier) observed(ctx context.Context, p service.DNSProvider, m config.MonitorConfig, c check, target string) (bool, error) {
+	if c.resolver == "" {
+		records, err := p.LookupRecords(ctx, m.ZoneID, c.name, c.typ, m.RecordLine)
+		if err != nil {
+			return false, err
+		}
+		for _, r := range records {
+			if strings.EqualFold(r.Type, c.typ) && service.SameContent(r.Content, target) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	qtype, ok := dns.StringToType[strings.ToUpper(c.typ)]
+	if !ok {
+		return false, fmt.Errorf("unsupported record type %s", c.typ)
+	}
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(c.name), qtype)
+	client := &dns.Client{Timeout: queryTimeout}
+	resp, _, err := client.ExchangeContext(ctx, msg, c.resolver)
+	if err != nil {
+		return false, err
+	}
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype != qtype {
+			continue
+		}
+		if service.SameContent(strings.TrimPrefix(rr.String(), rr.Header().String()), target) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (v *Verifier) record(monitorID, ip, result string, elapsed time.Duration) {
+	if _, err := v.store.SetSwitchPropagation(monitorID, ip, result, elapsed.Milliseconds()); err != nil {
+		log.Printf("Failed to save propagation result: %v", err)
+	}
+}
+
+func (v *Verifier) notify(msg string) {
+	log.Println(msg)
+	service.NewNotificationService(v.store.GetDingTalkConfig(), v.store.GetEmailConfig(), v.store.GetTelegramConfig()).Notify(msg)
+}
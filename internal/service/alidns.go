@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dns-failover/internal/config"
+)
+
+const (
+	alidnsEndpoint    = "https://alidns.aliyuncs.com/"
+	alidnsDefaultLine = "default"
+)
+
+// AlidnsProvider implements DNSProvider over the Alibaba Cloud DNS RPC API (2015-01-09). Zones are
+// identified by domain name, and records carry their resolution line (e.g. "telecom", "unicom").
+type AlidnsProvider struct {
+	keyID     string
+	keySecret string
+	endpoint  string
+	client    *http.Client
+}
+
+func NewAlidnsProvider(cfg config.DNSProviderConfig) (*AlidnsProvider, error) {
+	if cfg.AccessKeyID == "" || cfg.AccessKeySecret == "" {
+		return nil, fmt.Errorf("alidns: access_key_id and access_key_secret are required")
+	}
+	return &AlidnsProvider{
+		keyID:     cfg.AccessKeyID,
+		keySecret: cfg.AccessKeySecret,
+		endpoint:  alidnsEndpoint,
+		client:    &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+type alidnsRecord struct {
+	RecordID string `json:"RecordId"`
+	RR       string `json:"RR"`
+	Type     string `json:"Type"`
+	Value    string `json:"Value"`
+	TTL      int    `json:"TTL"`
+	Line     string `json:"Line"`
+	Priority int    `json:"Priority"`
+	Remark   string `json:"Remark"`
+}
+
+func (p *AlidnsProvider) ListZones(ctx context.Context) ([]Zone, error) {
+	var out []Zone
+	for page := 1; ; page++ {
+		var resp struct {
+			TotalCount int `json:"TotalCount"`
+			Domains    struct {
+				Domain []struct {
+					DomainID    string `json:"DomainId"`
+					DomainName  string `json:"DomainName"`
+					CreateStamp int64  `json:"CreateTimestamp"`
+				} `json:"Domain"`
+			} `json:"Domains"`
+		}
+		err := p.call(ctx, "DescribeDomains", map[string]string{
+			"PageNumber": strconv.Itoa(page),
+			"PageSize":   "100",
+		}, &resp)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range resp.Domains.Domain {
+			out = append(out, Zone{ID: d.DomainName, Name: d.DomainName, Status: "active", CreatedOn: time.UnixMilli(d.CreateStamp)})
+		}
+		if len(resp.Domains.Domain) == 0 || len(out) >= resp.TotalCount {
+			return out, nil
+		}
+	}
+}
+
+func (p *AlidnsProvider) ListRecords(ctx context.Context, zoneID string) ([]Record, error) {
+	records, err := p.describe(ctx, "DescribeDomainRecords", map[string]string{"DomainName": zoneID})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Record, 0, len(records))
+	for _, r := range records {
+		out = append(out, alidnsToRecord(zoneID, r))
+	}
+	return out, nil
+}
+
+func (p *AlidnsProvider) CreateRecord(ctx context.Context, zoneID string, record Record) (Record, error) {
+	params := alidnsParams(zoneID, record)
+	params["DomainName"] = zoneID
+	var resp struct {
+		RecordID string `json:"RecordId"`
+	}
+	if err := p.call(ctx, "AddDomainRecord", params, &resp); err != nil {
+		return Record{}, err
+	}
+	if err := p.setRemark(ctx, resp.RecordID, record.Comment); err != nil {
+		return Record{}, err
+	}
+	record.ID = resp.RecordID
+	return record, nil
+}
+
+func (p *AlidnsProvider) UpdateRecord(ctx context.Context, zoneID string, record Record) (Record, error) {
+	params := alidnsParams(zoneID, record)
+	params["RecordId"] = record.ID
+	if err := p.call(ctx, "UpdateDomainRecord", params, nil); err != nil && !alidnsUnchanged(err) {
+		return Record{}, err
+	}
+	if err := p.setRemark(ctx, record.ID, record.Comment); err != nil {
+		return Record{}, err
+	}
+	return record, nil
+}
+
+func (p *AlidnsProvider) DeleteRecord(ctx context.Context, zoneID, recordID string) error {
+	return p.call(ctx, "DeleteDomainRecord", map[string]string{"RecordId": recordID}, nil)
+}
+
+func (p *AlidnsProvider) DefaultLine() string { return alidnsDefaultLine }
+
+// UpdateRecordBySubdomain switches only the subdomain's records on opts.Line (the default line when
+// empty), so every ISP line can fail over on its own.
+func (p *AlidnsProvider) UpdateRecordBySubdomain(ctx context.Context, zoneID, subdomain, target string, opts UpdateOptions) ([]RecordResult, error) {
+	if opts.Line == "" {
+		opts.Line = alidnsDefaultLine
+	}
+	candidates, err := p.LookupRecords(ctx, zoneID, subdomain, TargetType(target, opts.Type), opts.Line)
+	if err != nil {
+		return nil, err
+	}
+	return switchRecords(ctx, p, zoneID, absoluteName(relativeName(subdomain, zoneID), zoneID), target, opts, candidates)
+}
+
+func (p *AlidnsProvider) LookupRecords(ctx context.Context, zoneID, subdomain, typ, line string) ([]Record, error) {
+	if line == "" {
+		line = alidnsDefaultLine
+	}
+	records, err := p.describe(ctx, "DescribeSubDomainRecords", map[string]string{
+		"SubDomain":  absoluteName(relativeName(subdomain, zoneID), zoneID),
+		"DomainName": zoneID,
+		"Type":       strings.ToUpper(typ),
+		"Line":       line,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out []Record
+	for _, r := range records {
+		if r.Line == line {
+			out = append(out, alidnsToRecord(zoneID, r))
+		}
+	}
+	return out, nil
+}
+
+func (p *AlidnsProvider) describe(ctx context.Context, action string, params map[string]string) ([]alidnsRecord, error) {
+	var out []alidnsRecord
+	for page := 1; ; page++ {
+		var resp struct {
+			TotalCount    int `json:"TotalCount"`
+			DomainRecords struct {
+				Record []alidnsRecord `json:"Record"`
+			} `json:"DomainRecords"`
+		}
+		q := map[string]string{"PageNumber": strconv.Itoa(page), "PageSize": "500"}
+		for k, v := range params {
+			q[k] = v
+		}
+		if err := p.call(ctx, action, q, &resp); err != nil {
+			return nil, err
+		}
+		out = append(out, resp.DomainRecords.Record...)
+		if len(resp.DomainRecords.Record) == 0 || len(out) >= resp.TotalCount {
+			return out, nil
+		}
+	}
+}
+
+func (p *AlidnsProvider) setRemark(ctx context.Context, recordID, remark string) error {
+	if remark == "" {
+		return nil
+	}
+	return p.call(ctx, "UpdateDomainRecordRemark", map[string]string{"RecordId": recordID, "Remark": remark}, nil)
+}
+
+// call performs a signed RPC request (signature version 1.0, HMAC-SHA1).
+func (p *AlidnsProvider) call(ctx context.Context, action string, params map[string]string, out any) error {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+
+	q := map[string]string{
+		"Action":           action,
+		"Format":           "JSON",
+		"Version":          "2015-01-09",
+		"AccessKeyId":      p.keyID,
+		"SignatureMethod":  "HMAC-SHA1",
+		"SignatureVersion": "1.0",
+		"SignatureNonce":   hex.EncodeToString(nonce),
+		"Timestamp":        time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	for k, v := range params {
+		if v != "" {
+			q[k] = v
+		}
+	}
+
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, alidnsEscape(k)+"="+alidnsEscape(q[k]))
+	}
+	query := strings.Join(pairs, "&")
+
+	mac := hmac.New(sha1.New, []byte(p.keySecret+"&"))
+	mac.Write([]byte("GET&%2F&" + alidnsEscape(query)))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint+"?"+query+"&Signature="+alidnsEscape(signature), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("alidns: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("alidns: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Code != "" {
+			err := fmt.Errorf("alidns: %s: %s: %s", action, apiErr.Code, apiErr.Message)
+			if strings.HasPrefix(apiErr.Code, "Throttling") {
+				return &RateLimitError{Provider: ProviderAlidns, Err: err}
+			}
+			return err
+		}
+		return fmt.Errorf("alidns: %s: %s", action, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
+
+// alidnsUnchanged reports the error Alidns returns when an update would not change the record.
+func alidnsUnchanged(err error) bool {
+	return strings.Contains(err.Error(), "DomainRecordDuplicate")
+}
+
+// alidnsEscape is the RFC 3986 percent-encoding the Alibaba Cloud signature requires.
+func alidnsEscape(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	s = strings.ReplaceAll(s, "*", "%2A")
+	return strings.ReplaceAll(s, "%7E", "~")
+}
+
+func alidnsParams(zoneID string, record Record) map[string]string {
+	params := map[string]string{
+		"RR":    relativeName(record.Name, zoneID),
+		"Type":  strings.ToUpper(record.Type),
+		"Value": record.Content,
+		"Line":  record.Line,
+	}
+	if record.TTL > 1 {
+		params["TTL"] = strconv.Itoa(record.TTL)
+	}
+	if record.Priority != nil {
+		params["Priority"] = strconv.Itoa(int(*record.Priority))
+	}
+	return params
+}
+
+func alidnsToRecord(zoneID string, r alidnsRecord) Record {
+	record := Record{
+		ID:      r.RecordID,
+		Type:    r.Type,
+		Name:    absoluteName(r.RR, zoneID),
+		Content: r.Value,
+		TTL:     r.TTL,
+		Line:    r.Line,
+		Comment: r.Remark,
+	}
+	if r.Type == "MX" {
+		prio := uint16(r.Priority)
+		record.Priority = &prio
+	}
+	return record
+}
+
+// relativeName turns a record name into the host part these APIs expect: "www" for www.example.com
+// and "@" for the apex. Names that are already relative are returned unchanged.
+func relativeName(name, zone string) string {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	zone = strings.TrimSuffix(strings.ToLower(zone), ".")
+	switch {
+	case name == "" || name == "@" || name == zone:
+		return "@"
+	case strings.HasSuffix(name, "."+zone):
+		return strings.TrimSuffix(name, "."+zone)
+	default:
+		return name
+	}
+}
+
+func absoluteName(rr, zone string) string {
+	if rr == "" || rr == "@" {
+		return zone
+	}
+	return rr + "." + zone
+}
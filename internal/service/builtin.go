@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"dns-failover/internal/config"
+)
+
+// BuiltinProvider stands for zones served by the built-in DNS server. The server answers from the
+// engine's state, so a switch needs no API call and records cannot be edited by hand.
+type BuiltinProvider struct {
+	zones []string
+}
+
+func NewBuiltinProvider(cfg config.DNSProviderConfig) (*BuiltinProvider, error) {
+	if len(cfg.Zones) == 0 {
+		return nil, fmt.Errorf("builtin: zones is required")
+	}
+	return &BuiltinProvider{zones: cfg.Zones}, nil
+}
+
+func (p *BuiltinProvider) ListZones(ctx context.Context) ([]Zone, error) {
+	out := make([]Zone, 0, len(p.zones))
+	for _, z := range p.zones {
+		name := strings.TrimSuffix(z, ".")
+		out = append(out, Zone{ID: name, Name: name, Status: "active"})
+	}
+	return out, nil
+}
+
+func (p *BuiltinProvider) ListRecords(ctx context.Context, zoneID string) ([]Record, error) {
+	return []Record{}, nil
+}
+
+func (p *BuiltinProvider) CreateRecord(ctx context.Context, zoneID string, record Record) (Record, error) {
+	return Record{}, errBuiltinReadOnly
+}
+
+func (p *BuiltinProvider) UpdateRecord(ctx context.Context, zoneID string, record Record) (Record, error) {
+	return Record{}, errBuiltinReadOnly
+}
+
+func (p *BuiltinProvider) DeleteRecord(ctx context.Context, zoneID, recordID string) error {
+	return errBuiltinReadOnly
+}
+
+// UpdateRecordBySubdomain is a no-op: the built-in server already answers with the monitor's current IP.
+func (p *BuiltinProvider) UpdateRecordBySubdomain(ctx context.Context, zoneID, subdomain, target string, opts UpdateOptions) ([]RecordResult, error) {
+	return nil, nil
+}
+
+// LookupRecords returns nothing: the built-in server's answers live in the engine, not in records.
+func (p *BuiltinProvider) LookupRecords(ctx context.Context, zoneID, subdomain, typ, line string) ([]Record, error) {
+	return nil, nil
+}
+
+var errBuiltinReadOnly = fmt.Errorf("builtin: records are served from monitor state and cannot be edited")
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"dns-failover/internal/config"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// CloudflareProvider implements DNSProvider over the Cloudflare API.
+type CloudflareProvider struct {
+	api *cloudflare.API
+}
+
+func NewCloudflareProvider(cfg config.CloudflareConfig) (*CloudflareProvider, error) {
+	var (
+		api *cloudflare.API
+		err error
+	)
+
+	// Retries are left to the caller (see the outbox), so a 429's Retry-After is honoured instead of
+	// being replaced by the client's own backoff.
+	opts := []cloudflare.Option{
+		cloudflare.HTTPClient(&http.Client{Transport: rateLimitTransport{provider: ProviderCloudflare, base: http.DefaultTransport}}),
+		cloudflare.UsingRetryPolicy(0, 1, 30),
+	}
+	if cfg.APIToken != "" {
+		api, err = cloudflare.NewWithAPIToken(cfg.APIToken, opts...)
+	} else {
+		api, err = cloudflare.New(cfg.APIKey, cfg.Email, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &CloudflareProvider{api: api}, nil
+}
+
+// ListZones 获取所有域名列表
+func (s *CloudflareProvider) ListZones(ctx context.Context) ([]Zone, error) {
+	zones, err := s.api.ListZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Zone, 0, len(zones))
+	for _, z := range zones {
+		out = append(out, Zone{ID: z.ID, Name: z.Name, Status: z.Status, Type: z.Type, CreatedOn: z.CreatedOn})
+	}
+	return out, nil
+}
+
+// ListRecords 获取特定 Zone 的所有解析记录
+func (s *CloudflareProvider) ListRecords(ctx context.Context, zoneID string) ([]Record, error) {
+	records, _, err := s.api.ListDNSRecords(ctx, cloudflare.ZoneIdentifier(zoneID), cloudflare.ListDNSRecordsParams{})
+	if err != nil {
+		return nil, err
+	}
+	return fromCloudflareRecords(records), nil
+}
+
+// GetRecord 获取特定解析记录详情
+func (s *CloudflareProvider) GetRecord(ctx context.Context, zoneID, recordID string) (Record, error) {
+	r, err := s.api.GetDNSRecord(ctx, cloudflare.ZoneIdentifier(zoneID), recordID)
+	if err != nil {
+		return Record{}, err
+	}
+	return fromCloudflareRecord(r), nil
+}
+
+// CreateRecord 创建解析记录
+func (s *CloudflareProvider) CreateRecord(ctx context.Context, zoneID string, record Record) (Record, error) {
+	r, err := s.api.CreateDNSRecord(ctx, cloudflare.ZoneIdentifier(zoneID), cloudflare.CreateDNSRecordParams{
+		Type:     record.Type,
+		Name:     record.Name,
+		Content:  record.Content,
+		TTL:      record.TTL,
+		Proxied:  record.Proxied,
+		Priority: record.Priority,
+		Comment:  record.Comment,
+		Tags:     record.Tags,
+	})
+	if err != nil {
+		return Record{}, err
+	}
+	return fromCloudflareRecord(r), nil
+}
+
+// UpdateRecord 更新解析记录
+func (s *CloudflareProvider) UpdateRecord(ctx context.Context, zoneID string, record Record) (Record, error) {
+	params := cloudflare.UpdateDNSRecordParams{
+		ID:       record.ID,
+		Type:     record.Type,
+		Name:     record.Name,
+		Content:  record.Content,
+		TTL:      record.TTL,
+		Proxied:  record.Proxied,
+		Priority: record.Priority,
+		Tags:     record.Tags,
+		// Always sent, so clearing a comment through the API works.
+		Comment: &record.Comment,
+	}
+	r, err := s.api.UpdateDNSRecord(ctx, cloudflare.ZoneIdentifier(zoneID), params)
+	if err != nil {
+		return Record{}, err
+	}
+	return fromCloudflareRecord(r), nil
+}
+
+// DeleteRecord 删除解析记录
+func (s *CloudflareProvider) DeleteRecord(ctx context.Context, zoneID, recordID string) error {
+	return s.api.DeleteDNSRecord(ctx, cloudflare.ZoneIdentifier(zoneID), recordID)
+}
+
+// UpdateRecordBySubdomain 根据子域名切换解析记录 (用于 Failover)
+func (s *CloudflareProvider) UpdateRecordBySubdomain(ctx context.Context, zoneID, subdomain, target string, opts UpdateOptions) ([]RecordResult, error) {
+	records, err := s.LookupRecords(ctx, zoneID, subdomain, TargetType(target, opts.Type), opts.Line)
+	if err != nil {
+		return nil, err
+	}
+	return switchRecords(ctx, s, zoneID, subdomain, target, opts, records)
+}
+
+// LookupRecords 查询子域名下指定类型的解析记录
+func (s *CloudflareProvider) LookupRecords(ctx context.Context, zoneID, subdomain, typ, line string) ([]Record, error) {
+	records, _, err := s.api.ListDNSRecords(ctx, cloudflare.ZoneIdentifier(zoneID), cloudflare.ListDNSRecordsParams{
+		Name: subdomain,
+		Type: typ,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromCloudflareRecords(records), nil
+}
+
+// SearchRecords 搜索解析记录
+func (s *CloudflareProvider) SearchRecords(ctx context.Context, zoneID, query string) ([]Record, error) {
+	records, err := s.ListRecords(ctx, zoneID)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Record
+	query = strings.ToLower(query)
+	for _, record := range records {
+		if strings.Contains(strings.ToLower(record.Name), query) ||
+			strings.Contains(strings.ToLower(record.Content), query) ||
+			strings.Contains(strings.ToLower(record.Type), query) {
+			results = append(results, record)
+		}
+	}
+	return results, nil
+}
+
+// BulkUpdateRecords 批量更新解析记录
+func (s *CloudflareProvider) BulkUpdateRecords(ctx context.Context, zoneID string, updates []BulkUpdateRequest) ([]BulkUpdateResult, error) {
+	var results []BulkUpdateResult
+
+	for _, update := range updates {
+		result := BulkUpdateResult{
+			RecordID: update.RecordID,
+			Success:  false,
+		}
+
+		record, err := s.GetRecord(ctx, zoneID, update.RecordID)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		if update.Content != "" {
+			record.Content = update.Content
+		}
+		if update.TTL > 0 {
+			record.TTL = update.TTL
+		}
+		if update.Proxied != nil {
+			record.Proxied = update.Proxied
+		}
+
+		_, err = s.UpdateRecord(ctx, zoneID, record)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Success = true
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// GetZoneAnalytics 获取域名分析数据
+func (s *CloudflareProvider) GetZoneAnalytics(ctx context.Context, zoneID string) (cloudflare.ZoneAnalyticsData, error) {
+	return s.api.ZoneAnalyticsDashboard(ctx, zoneID, cloudflare.ZoneAnalyticsOptions{})
+}
+
+// GetZoneSettings 获取域名设置
+func (s *CloudflareProvider) GetZoneSettings(ctx context.Context, zoneID string) (*cloudflare.ZoneSettingResponse, error) {
+	return s.api.ZoneSettings(ctx, zoneID)
+}
+
+// UpdateZoneSetting 更新域名设置
+func (s *CloudflareProvider) UpdateZoneSetting(ctx context.Context, zoneID string, setting cloudflare.ZoneSetting) (cloudflare.ZoneSetting, error) {
+	return s.api.UpdateZoneSetting(ctx, &cloudflare.ResourceContainer{Identifier: zoneID}, cloudflare.UpdateZoneSettingParams{
+		Name:  setting.ID,
+		Value: setting.Value,
+	})
+}
+
+// BulkUpdateRequest 批量更新请求
+type BulkUpdateRequest struct {
+	RecordID string `json:"record_id"`
+	Content  string `json:"content,omitempty"`
+	TTL      int    `json:"ttl,omitempty"`
+	Proxied  *bool  `json:"proxied,omitempty"`
+}
+
+// BulkUpdateResult 批量更新结果
+type BulkUpdateResult struct {
+	RecordID string `json:"record_id"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error,omitempty"`
+}
+
+func fromCloudflareRecords(in []cloudflare.DNSRecord) []Record {
+	out := make([]Record, 0, len(in))
+	for _, r := range in {
+		out = append(out, fromCloudflareRecord(r))
+	}
+	return out
+}
+
+func fromCloudflareRecord(r cloudflare.DNSRecord) Record {
+	return Record{
+		ID:       r.ID,
+		Type:     r.Type,
+		Name:     r.Name,
+		Content:  r.Content,
+		TTL:      r.TTL,
+		Proxied:  r.Proxied,
+		Priority: r.Priority,
+		Comment:  r.Comment,
+		Tags:     r.Tags,
+	}
+}
@@ -0,0 +1,315 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"dns-failover/internal/config"
+)
+
+const (
+	dnspodHost        = "dnspod.tencentcloudapi.com"
+	dnspodDefaultLine = "默认"
+)
+
+// DNSPodProvider implements DNSProvider over the Tencent Cloud DNSPod API 3.0. Zones are identified
+// by domain name, and records carry their resolution line (e.g. "电信", "联通").
+type DNSPodProvider struct {
+	secretID  string
+	secretKey string
+	endpoint  string
+	client    *http.Client
+}
+
+func NewDNSPodProvider(cfg config.DNSProviderConfig) (*DNSPodProvider, error) {
+	if cfg.SecretID == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("dnspod: secret_id and secret_key are required")
+	}
+	return &DNSPodProvider{
+		secretID:  cfg.SecretID,
+		secretKey: cfg.SecretKey,
+		endpoint:  "https://" + dnspodHost,
+		client:    &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+type dnspodRecord struct {
+	RecordID uint64 `json:"RecordId"`
+	Name     string `json:"Name"`
+	Type     string `json:"Type"`
+	Value    string `json:"Value"`
+	TTL      int    `json:"TTL"`
+	Line     string `json:"Line"`
+	MX       int    `json:"MX"`
+	Remark   string `json:"Remark"`
+}
+
+func (p *DNSPodProvider) ListZones(ctx context.Context) ([]Zone, error) {
+	var out []Zone
+	for offset := 0; ; {
+		var resp struct {
+			DomainCountInfo struct {
+				AllTotal int `json:"AllTotal"`
+			} `json:"DomainCountInfo"`
+			DomainList []struct {
+				Name      string `json:"Name"`
+				Status    string `json:"Status"`
+				CreatedOn string `json:"CreatedOn"`
+			} `json:"DomainList"`
+		}
+		if err := p.call(ctx, "DescribeDomainList", map[string]any{"Offset": offset, "Limit": 3000}, &resp); err != nil {
+			return nil, err
+		}
+		for _, d := range resp.DomainList {
+			status := "active"
+			if d.Status != "ENABLE" {
+				status = strings.ToLower(d.Status)
+			}
+			created, _ := time.ParseInLocation("2006-01-02 15:04:05", d.CreatedOn, time.Local)
+			out = append(out, Zone{ID: d.Name, Name: d.Name, Status: status, CreatedOn: created})
+		}
+		offset += len(resp.DomainList)
+		if len(resp.DomainList) == 0 || offset >= resp.DomainCountInfo.AllTotal {
+			return out, nil
+		}
+	}
+}
+
+func (p *DNSPodProvider) ListRecords(ctx context.Context, zoneID string) ([]Record, error) {
+	records, err := p.describe(ctx, map[string]any{"Domain": zoneID})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Record, 0, len(records))
+	for _, r := range records {
+		out = append(out, dnspodToRecord(zoneID, r))
+	}
+	return out, nil
+}
+
+func (p *DNSPodProvider) CreateRecord(ctx context.Context, zoneID string, record Record) (Record, error) {
+	var resp struct {
+		RecordID uint64 `json:"RecordId"`
+	}
+	if err := p.call(ctx, "CreateRecord", dnspodParams(zoneID, record), &resp); err != nil {
+		return Record{}, err
+	}
+	record.ID = strconv.FormatUint(resp.RecordID, 10)
+	return record, nil
+}
+
+func (p *DNSPodProvider) UpdateRecord(ctx context.Context, zoneID string, record Record) (Record, error) {
+	id, err := strconv.ParseUint(record.ID, 10, 64)
+	if err != nil {
+		return Record{}, fmt.Errorf("dnspod: invalid record id %q", record.ID)
+	}
+	params := dnspodParams(zoneID, record)
+	params["RecordId"] = id
+	if err := p.call(ctx, "ModifyRecord", params, nil); err != nil {
+		return Record{}, err
+	}
+	return record, nil
+}
+
+func (p *DNSPodProvider) DeleteRecord(ctx context.Context, zoneID, recordID string) error {
+	id, err := strconv.ParseUint(recordID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("dnspod: invalid record id %q", recordID)
+	}
+	return p.call(ctx, "DeleteRecord", map[string]any{"Domain": zoneID, "RecordId": id}, nil)
+}
+
+func (p *DNSPodProvider) DefaultLine() string { return dnspodDefaultLine }
+
+// UpdateRecordBySubdomain switches only the subdomain's records on opts.Line (the default line when
+// empty), so every ISP line can fail over on its own.
+func (p *DNSPodProvider) UpdateRecordBySubdomain(ctx context.Context, zoneID, subdomain, target string, opts UpdateOptions) ([]RecordResult, error) {
+	if opts.Line == "" {
+		opts.Line = dnspodDefaultLine
+	}
+	candidates, err := p.LookupRecords(ctx, zoneID, subdomain, TargetType(target, opts.Type), opts.Line)
+	if err != nil {
+		return nil, err
+	}
+	return switchRecords(ctx, p, zoneID, absoluteName(relativeName(subdomain, zoneID), zoneID), target, opts, candidates)
+}
+
+func (p *DNSPodProvider) LookupRecords(ctx context.Context, zoneID, subdomain, typ, line string) ([]Record, error) {
+	if line == "" {
+		line = dnspodDefaultLine
+	}
+	records, err := p.describe(ctx, map[string]any{
+		"Domain":     zoneID,
+		"Subdomain":  relativeName(subdomain, zoneID),
+		"RecordType": strings.ToUpper(typ),
+		"RecordLine": line,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out []Record
+	for _, r := range records {
+		if r.Line == line {
+			out = append(out, dnspodToRecord(zoneID, r))
+		}
+	}
+	return out, nil
+}
+
+func (p *DNSPodProvider) describe(ctx context.Context, params map[string]any) ([]dnspodRecord, error) {
+	var out []dnspodRecord
+	for offset := 0; ; {
+		var resp struct {
+			RecordCountInfo struct {
+				TotalCount int `json:"TotalCount"`
+			} `json:"RecordCountInfo"`
+			RecordList []dnspodRecord `json:"RecordList"`
+		}
+		q := map[string]any{"Offset": offset, "Limit": 3000}
+		for k, v := range params {
+			q[k] = v
+		}
+		err := p.call(ctx, "DescribeRecordList", q, &resp)
+		if err != nil {
+			// An empty result is reported as an error rather than an empty list.
+			if strings.Contains(err.Error(), "ResourceNotFound.NoDataOfRecord") {
+				return out, nil
+			}
+			return nil, err
+		}
+		out = append(out, resp.RecordList...)
+		offset += len(resp.RecordList)
+		if len(resp.RecordList) == 0 || offset >= resp.RecordCountInfo.TotalCount {
+			return out, nil
+		}
+	}
+}
+
+// call performs a request signed with TC3-HMAC-SHA256.
+func (p *DNSPodProvider) call(ctx context.Context, action string, params map[string]any, out any) error {
+	payload, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	date := now.Format("2006-01-02")
+	const contentType = "application/json; charset=utf-8"
+
+	canonical := "POST\n/\n\ncontent-type:" + contentType + "\nhost:" + dnspodHost + "\n\ncontent-type;host\n" + sha256Hex(payload)
+	scope := date + "/dnspod/tc3_request"
+	stringToSign := "TC3-HMAC-SHA256\n" + timestamp + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("TC3"+p.secretKey), date)
+	key = hmacSHA256(key, "dnspod")
+	key = hmacSHA256(key, "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Host", dnspodHost)
+	req.Header.Set("X-TC-Action", action)
+	req.Header.Set("X-TC-Version", "2021-03-23")
+	req.Header.Set("X-TC-Timestamp", timestamp)
+	req.Header.Set("Authorization", fmt.Sprintf("TC3-HMAC-SHA256 Credential=%s/%s, SignedHeaders=content-type;host, Signature=%s", p.secretID, scope, signature))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("dnspod: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("dnspod: %w", err)
+	}
+	var envelope struct {
+		Response json.RawMessage `json:"Response"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("dnspod: %s: %s", action, resp.Status)
+	}
+	var apiErr struct {
+		Error *struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		} `json:"Error"`
+	}
+	if json.Unmarshal(envelope.Response, &apiErr) == nil && apiErr.Error != nil {
+		err := fmt.Errorf("dnspod: %s: %s: %s", action, apiErr.Error.Code, apiErr.Error.Message)
+		if strings.HasPrefix(apiErr.Error.Code, "RequestLimitExceeded") {
+			return &RateLimitError{Provider: ProviderDNSPod, Err: err}
+		}
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(envelope.Response, out)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func dnspodParams(zoneID string, record Record) map[string]any {
+	line := record.Line
+	if line == "" {
+		line = dnspodDefaultLine
+	}
+	params := map[string]any{
+		"Domain":     zoneID,
+		"SubDomain":  relativeName(record.Name, zoneID),
+		"RecordType": strings.ToUpper(record.Type),
+		"RecordLine": line,
+		"Value":      record.Content,
+	}
+	if record.TTL > 1 {
+		params["TTL"] = record.TTL
+	}
+	if record.Priority != nil {
+		params["MX"] = *record.Priority
+	}
+	if record.Comment != "" {
+		params["Remark"] = record.Comment
+	}
+	return params
+}
+
+func dnspodToRecord(zoneID string, r dnspodRecord) Record {
+	record := Record{
+		ID:      strconv.FormatUint(r.RecordID, 10),
+		Type:    r.Type,
+		Name:    absoluteName(r.Name, zoneID),
+		Content: r.Value,
+		TTL:     r.TTL,
+		Line:    r.Line,
+		Comment: r.Remark,
+	}
+	if r.Type == "MX" {
+		prio := uint16(r.MX)
+		record.Priority = &prio
+	}
+	return record
+}
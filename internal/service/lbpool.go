@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"dns-failover/internal/config"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// Monitor actions accepted in config.MonitorConfig.Action.
+const (
+	ActionDNS    = "dns"
+	ActionLBPool = "lb_pool"
+)
+
+// LB pool switch modes accepted in config.MonitorConfig.LBMode.
+const (
+	LBModeEnable = "enable"
+	LBModeWeight = "weight"
+)
+
+// ValidateLBPool checks the load balancer settings of an lb_pool monitor.
+func ValidateLBPool(m config.MonitorConfig) error {
+	if m.LBAccountID == "" || m.LBPoolID == "" {
+		return fmt.Errorf("lb_account_id and lb_pool_id are required for the lb_pool action")
+	}
+	switch m.LBMode {
+	case "", LBModeEnable, LBModeWeight:
+	default:
+		return fmt.Errorf("unsupported lb_mode %q", m.LBMode)
+	}
+	return nil
+}
+
+// SwitchLBPool makes ip the serving origin of the monitor's load balancer pool. The origin matching ip
+// (original or backup) is enabled, or given weight 1, and the other one is disabled, or given weight 0.
+// Other origins in the pool are left untouched.
+func (s *CloudflareProvider) SwitchLBPool(ctx context.Context, m config.MonitorConfig, ip string) error {
+	if err := ValidateLBPool(m); err != nil {
+		return err
+	}
+
+	originalName, backupName := m.LBOriginalOrigin, m.LBBackupOrigin
+	if originalName == "" {
+		originalName = m.OriginalIP
+	}
+	if backupName == "" {
+		backupName = m.BackupIP
+	}
+	active, inactive := originalName, backupName
+	switch ip {
+	case m.OriginalIP:
+	case m.BackupIP:
+		active, inactive = backupName, originalName
+	default:
+		return fmt.Errorf("lb_pool: %s is neither the original nor the backup IP", ip)
+	}
+
+	rc := cloudflare.AccountIdentifier(m.LBAccountID)
+	pool, err := s.api.GetLoadBalancerPool(ctx, rc, m.LBPoolID)
+	if err != nil {
+		return err
+	}
+
+	activeIdx, inactiveIdx := findOrigin(pool.Origins, active), findOrigin(pool.Origins, inactive)
+	if activeIdx < 0 {
+		return fmt.Errorf("lb_pool: origin %s not found in pool %s", active, pool.Name)
+	}
+	if inactiveIdx < 0 {
+		return fmt.Errorf("lb_pool: origin %s not found in pool %s", inactive, pool.Name)
+	}
+
+	if m.LBMode == LBModeWeight {
+		pool.Origins[activeIdx].Enabled = true
+		pool.Origins[activeIdx].Weight = 1
+		pool.Origins[inactiveIdx].Weight = 0
+	} else {
+		pool.Origins[activeIdx].Enabled = true
+		pool.Origins[inactiveIdx].Enabled = false
+	}
+
+	_, err = s.api.UpdateLoadBalancerPool(ctx, rc, cloudflare.UpdateLoadBalancerPoolParams{LoadBalancer: pool})
+	return err
+}
+
+// findOrigin returns the index of the origin whose name or address is key, or -1.
+func findOrigin(origins []cloudflare.LoadBalancerOrigin, key string) int {
+	for i, o := range origins {
+		if strings.EqualFold(o.Name, key) || strings.EqualFold(o.Address, key) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"dns-failover/internal/config"
+)
+
+// PowerDNSProvider implements DNSProvider over the PowerDNS Authoritative HTTP API. PowerDNS manages
+// RRsets rather than single records, so a record's ID encodes its name, type and content.
+type PowerDNSProvider struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func NewPowerDNSProvider(cfg config.DNSProviderConfig) (*PowerDNSProvider, error) {
+	if cfg.APIURL == "" || cfg.APIKey == "" {
+		return nil, fmt.Errorf("powerdns: api_url and api_key are required")
+	}
+	serverID := cfg.ServerID
+	if serverID == "" {
+		serverID = "localhost"
+	}
+	return &PowerDNSProvider{
+		baseURL: strings.TrimRight(cfg.APIURL, "/") + "/api/v1/servers/" + url.PathEscape(serverID) + "/zones",
+		apiKey:  cfg.APIKey,
+		client:  &http.Client{Timeout: 15 * time.Second, Transport: rateLimitTransport{provider: ProviderPowerDNS, base: http.DefaultTransport}},
+	}, nil
+}
+
+type pdnsZone struct {
+	ID     string      `json:"id"`
+	Name   string      `json:"name"`
+	Kind   string      `json:"kind"`
+	RRsets []pdnsRRset `json:"rrsets,omitempty"`
+}
+
+type pdnsRRset struct {
+	Name       string        `json:"name"`
+	Type       string        `json:"type"`
+	TTL        int           `json:"ttl,omitempty"`
+	ChangeType string        `json:"changetype,omitempty"`
+	Records    []pdnsRecord  `json:"records"`
+	Comments   []pdnsComment `json:"comments,omitempty"`
+}
+
+type pdnsRecord struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+type pdnsComment struct {
+	Content string `json:"content"`
+	Account string `json:"account"`
+}
+
+func (p *PowerDNSProvider) ListZones(ctx context.Context) ([]Zone, error) {
+	var zones []pdnsZone
+	if err := p.do(ctx, http.MethodGet, "", nil, &zones); err != nil {
+		return nil, err
+	}
+	out := make([]Zone, 0, len(zones))
+	for _, z := range zones {
+		out = append(out, Zone{ID: z.ID, Name: strings.TrimSuffix(z.Name, "."), Status: "active", Type: strings.ToLower(z.Kind)})
+	}
+	return out, nil
+}
+
+func (p *PowerDNSProvider) ListRecords(ctx context.Context, zoneID string) ([]Record, error) {
+	zone, err := p.zone(ctx, zoneID)
+	if err != nil {
+		return nil, err
+	}
+	var out []Record
+	for _, set := range zone.RRsets {
+		if set.Type == "SOA" {
+			continue
+		}
+		for _, r := range set.Records {
+			out = append(out, pdnsToRecord(set, r))
+		}
+	}
+	return out, nil
+}
+
+func (p *PowerDNSProvider) CreateRecord(ctx context.Context, zoneID string, record Record) (Record, error) {
+	zone, err := p.zone(ctx, zoneID)
+	if err != nil {
+		return Record{}, err
+	}
+	name, typ := pdnsName(record.Name), strings.ToUpper(record.Type)
+	set := findRRset(zone, name, typ)
+	if set == nil {
+		set = &pdnsRRset{Name: name, Type: typ}
+	}
+	if record.TTL > 1 || set.TTL == 0 {
+		set.TTL = pdnsTTL(record.TTL)
+	}
+	content := pdnsContent(record)
+	addContent(set, content)
+	if err := p.replace(ctx, zoneID, *set); err != nil {
+		return Record{}, err
+	}
+	return pdnsToRecord(*set, pdnsRecord{Content: content}), nil
+}
+
+func (p *PowerDNSProvider) UpdateRecord(ctx context.Context, zoneID string, record Record) (Record, error) {
+	oldName, oldType, oldContent, err := pdnsDecodeID(record.ID)
+	if err != nil {
+		return Record{}, err
+	}
+	if record.Name == "" {
+		record.Name = oldName
+	}
+	if record.Type == "" {
+		record.Type = oldType
+	}
+
+	zone, err := p.zone(ctx, zoneID)
+	if err != nil {
+		return Record{}, err
+	}
+	old := findRRset(zone, oldName, oldType)
+	if old == nil || !removeContent(old, oldContent) {
+		return Record{}, fmt.Errorf("powerdns: record %s %s %s not found", oldName, oldType, oldContent)
+	}
+
+	name, typ := pdnsName(record.Name), strings.ToUpper(record.Type)
+	content := pdnsContent(record)
+	var changes []pdnsRRset
+	target := old
+	if name != old.Name || typ != old.Type {
+		changes = append(changes, rrsetChange(*old))
+		if target = findRRset(zone, name, typ); target == nil {
+			target = &pdnsRRset{Name: name, Type: typ, TTL: old.TTL}
+		}
+	}
+	if record.TTL > 1 {
+		target.TTL = pdnsTTL(record.TTL)
+	}
+	addContent(target, content)
+	changes = append(changes, rrsetChange(*target))
+
+	if err := p.patch(ctx, zoneID, changes); err != nil {
+		return Record{}, err
+	}
+	return pdnsToRecord(*target, pdnsRecord{Content: content}), nil
+}
+
+func (p *PowerDNSProvider) DeleteRecord(ctx context.Context, zoneID, recordID string) error {
+	name, typ, content, err := pdnsDecodeID(recordID)
+	if err != nil {
+		return err
+	}
+	zone, err := p.zone(ctx, zoneID)
+	if err != nil {
+		return err
+	}
+	set := findRRset(zone, name, typ)
+	if set == nil || !removeContent(set, content) {
+		return fmt.Errorf("powerdns: record %s %s %s not found", name, typ, content)
+	}
+	return p.patch(ctx, zoneID, []pdnsRRset{rrsetChange(*set)})
+}
+
+// UpdateRecordBySubdomain replaces the matching records of subdomain's RRset with target, keeping the
+// RRset's TTL and comments.
+func (p *PowerDNSProvider) UpdateRecordBySubdomain(ctx context.Context, zoneID, subdomain, target string, opts UpdateOptions) ([]RecordResult, error) {
+	candidates, err := p.LookupRecords(ctx, zoneID, subdomain, TargetType(target, opts.Type), opts.Line)
+	if err != nil {
+		return nil, err
+	}
+	return switchRecords(ctx, p, zoneID, strings.TrimSuffix(subdomain, "."), target, opts, candidates)
+}
+
+func (p *PowerDNSProvider) LookupRecords(ctx context.Context, zoneID, subdomain, typ, line string) ([]Record, error) {
+	zone, err := p.zone(ctx, zoneID)
+	if err != nil {
+		return nil, err
+	}
+	var out []Record
+	if set := findRRset(zone, pdnsName(subdomain), strings.ToUpper(typ)); set != nil {
+		for _, r := range set.Records {
+			out = append(out, pdnsToRecord(*set, r))
+		}
+	}
+	return out, nil
+}
+
+func (p *PowerDNSProvider) zone(ctx context.Context, zoneID string) (pdnsZone, error) {
+	var zone pdnsZone
+	err := p.do(ctx, http.MethodGet, "/"+url.PathEscape(zoneID), nil, &zone)
+	return zone, err
+}
+
+func (p *PowerDNSProvider) replace(ctx context.Context, zoneID string, set pdnsRRset) error {
+	return p.patch(ctx, zoneID, []pdnsRRset{rrsetChange(set)})
+}
+
+func (p *PowerDNSProvider) patch(ctx context.Context, zoneID string, sets []pdnsRRset) error {
+	return p.do(ctx, http.MethodPatch, "/"+url.PathEscape(zoneID), map[string]any{"rrsets": sets}, nil)
+}
+
+func (p *PowerDNSProvider) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-API-Key", p.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("powerdns: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("powerdns: %s: %s", resp.Status, apiErr.Error)
+		}
+		return fmt.Errorf("powerdns: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// rrsetChange turns set into a PATCH entry: REPLACE with its records, or DELETE once it is empty.
+// Comments are left out so PowerDNS keeps the existing ones.
+func rrsetChange(set pdnsRRset) pdnsRRset {
+	change := pdnsRRset{Name: set.Name, Type: set.Type, TTL: set.TTL, ChangeType: "REPLACE", Records: set.Records}
+	if len(set.Records) == 0 {
+		change.ChangeType = "DELETE"
+		change.TTL = 0
+		change.Records = []pdnsRecord{}
+	}
+	return change
+}
+
+func findRRset(zone pdnsZone, name, typ string) *pdnsRRset {
+	for i := range zone.RRsets {
+		if strings.EqualFold(zone.RRsets[i].Name, name) && zone.RRsets[i].Type == typ {
+			return &zone.RRsets[i]
+		}
+	}
+	return nil
+}
+
+func removeContent(set *pdnsRRset, content string) bool {
+	for i, r := range set.Records {
+		if r.Content == content {
+			set.Records = append(set.Records[:i:i], set.Records[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// addContent appends content to set unless it is already there; PowerDNS rejects duplicate records.
+func addContent(set *pdnsRRset, content string) {
+	for _, r := range set.Records {
+		if r.Content == content {
+			return
+		}
+	}
+	set.Records = append(set.Records, pdnsRecord{Content: content})
+}
+
+func pdnsToRecord(set pdnsRRset, r pdnsRecord) Record {
+	record := Record{
+		ID:      pdnsEncodeID(set.Name, set.Type, r.Content),
+		Type:    set.Type,
+		Name:    strings.TrimSuffix(set.Name, "."),
+		Content: r.Content,
+		TTL:     set.TTL,
+	}
+	if len(set.Comments) > 0 {
+		record.Comment = set.Comments[0].Content
+	}
+	if set.Type == "MX" {
+		var prio uint16
+		var host string
+		if n, _ := fmt.Sscanf(r.Content, "%d %s", &prio, &host); n == 2 {
+			record.Priority = &prio
+			record.Content = host
+		}
+	}
+	return record
+}
+
+// pdnsName returns the canonical (fully qualified) name PowerDNS uses for RRsets.
+func pdnsName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+}
+
+func pdnsTTL(ttl int) int {
+	if ttl <= 1 {
+		return 300 // Cloudflare's "auto" TTL is 1
+	}
+	return ttl
+}
+
+// pdnsContent returns the record data in PowerDNS format: MX carries its priority, and names in
+// CNAME/NS/MX content must be fully qualified.
+func pdnsContent(record Record) string {
+	content := record.Content
+	switch strings.ToUpper(record.Type) {
+	case "CNAME", "NS", "MX":
+		content = pdnsName(content)
+	}
+	if strings.ToUpper(record.Type) == "MX" && record.Priority != nil {
+		content = fmt.Sprintf("%d %s", *record.Priority, content)
+	}
+	return content
+}
+
+func pdnsEncodeID(name, typ, content string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(name + "\n" + typ + "\n" + content))
+}
+
+func pdnsDecodeID(id string) (name, typ, content string, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(id)
+	parts := strings.SplitN(string(raw), "\n", 3)
+	if err != nil || len(parts) != 3 {
+		return "", "", "", fmt.Errorf("powerdns: invalid record id")
+	}
+	return parts[0], parts[1], parts[2], nil
+}
@@ -0,0 +1,398 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"dns-failover/internal/config"
+)
+
+// Provider types accepted in config.DNSProviderConfig.Type.
+const (
+	ProviderCloudflare = "cloudflare"
+	ProviderRFC2136    = "rfc2136"
+	ProviderPowerDNS   = "powerdns"
+	ProviderAlidns     = "alidns"
+	ProviderDNSPod     = "dnspod"
+	ProviderBuiltin    = "builtin"
+)
+
+// DNSProvider is a DNS backend the failover engine can drive. Zones and records are exposed in a
+// provider-neutral shape so the API and web UI work the same for every backend.
+type DNSProvider interface {
+	ListZones(ctx context.Context) ([]Zone, error)
+	ListRecords(ctx context.Context, zoneID string) ([]Record, error)
+	CreateRecord(ctx context.Context, zoneID string, record Record) (Record, error)
+	UpdateRecord(ctx context.Context, zoneID string, record Record) (Record, error)
+	DeleteRecord(ctx context.Context, zoneID, recordID string) error
+
+	// UpdateRecordBySubdomain points the records of subdomain at target; it is the write path used on
+	// failover and restore. It reports every record it touched, and returns an error if any of them
+	// failed or, unless opts.Create is set, if no record matched.
+	UpdateRecordBySubdomain(ctx context.Context, zoneID, subdomain, target string, opts UpdateOptions) ([]RecordResult, error)
+
+	// LookupRecords returns the records of subdomain with type typ, on the given line (the default line
+	// when empty) for a LineProvider. It is the read side of UpdateRecordBySubdomain.
+	LookupRecords(ctx context.Context, zoneID, subdomain, typ, line string) ([]Record, error)
+}
+
+// LineProvider is implemented by providers with line-specific (ISP based) records, such as Alidns and
+// DNSPod. Each line is switched on its own, so one monitor per line can fail over independently.
+type LineProvider interface {
+	// DefaultLine is the line switched when UpdateOptions.Line is empty.
+	DefaultLine() string
+}
+
+// UpdateOptions selects the records UpdateRecordBySubdomain switches.
+type UpdateOptions struct {
+	// Type is the record type to switch. Empty means A or AAAA by the target's address family, or CNAME
+	// when the target is a host name.
+	Type string
+	// RecordID restricts the switch to a single record.
+	RecordID string
+	// Line restricts the switch to one line on a LineProvider; empty means its default line.
+	Line string
+	// Proxied is applied to proxiable Cloudflare records; other providers ignore it.
+	Proxied bool
+	// Create adds the record when none matches, instead of failing.
+	Create bool
+	// Expected lists the contents the records may hold before the switch, normally the monitor's own IPs.
+	// Only records holding one of them are switched; the other records of the set are left alone.
+	Expected []string
+}
+
+// Outcomes reported in RecordResult.Status.
+const (
+	RecordUpdated   = "updated"
+	RecordUnchanged = "unchanged"
+	RecordCreated   = "created"
+	RecordSkipped   = "skipped"
+	RecordFailed    = "failed"
+)
+
+// RecordResult is the outcome of a failover write for one record.
+type RecordResult struct {
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Zone is a DNS zone. Field names follow the Cloudflare API, which the web UI was built against.
+type Zone struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Type      string    `json:"type"`
+	CreatedOn time.Time `json:"created_on"`
+}
+
+// Record is a DNS record. Proxied is only meaningful for Cloudflare, Line for line-aware providers.
+type Record struct {
+	ID       string   `json:"id"`
+	Type     string   `json:"type"`
+	Name     string   `json:"name"`
+	Content  string   `json:"content"`
+	TTL      int      `json:"ttl"`
+	Proxied  *bool    `json:"proxied,omitempty"`
+	Priority *uint16  `json:"priority,omitempty"`
+	Comment  string   `json:"comment,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Line     string   `json:"line,omitempty"`
+}
+
+// NewProvider builds the provider described by cfg.
+func NewProvider(cfg config.DNSProviderConfig) (DNSProvider, error) {
+	switch cfg.Type {
+	case ProviderCloudflare, "":
+		return NewCloudflareProvider(config.CloudflareConfig{APIToken: cfg.APIToken, APIKey: cfg.APIKey, Email: cfg.Email})
+	case ProviderRFC2136:
+		return NewRFC2136Provider(cfg)
+	case ProviderPowerDNS:
+		return NewPowerDNSProvider(cfg)
+	case ProviderAlidns:
+		return NewAlidnsProvider(cfg)
+	case ProviderDNSPod:
+		return NewDNSPodProvider(cfg)
+	case ProviderBuiltin:
+		return NewBuiltinProvider(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported DNS provider type %q", cfg.Type)
+	}
+}
+
+// ProviderForMonitor resolves the provider m switches through, honouring its Cloudflare account binding.
+func ProviderForMonitor(store *config.Store, m config.MonitorConfig) (DNSProvider, error) {
+	return ProviderForAccount(store, m.ProviderID, m.AccountID)
+}
+
+// ProviderForAccount resolves the provider a monitor or an API request refers to. An empty providerID
+// means Cloudflare, which is what every monitor used before providers were configurable: the account
+// accountID when set, otherwise the active account.
+func ProviderForAccount(store *config.Store, providerID, accountID string) (DNSProvider, error) {
+	if providerID == "" {
+		cfg := store.GetCloudflareConfig()
+		if accountID != "" {
+			var ok bool
+			if cfg, ok = store.GetCloudflareAccountConfig(accountID); !ok {
+				return nil, fmt.Errorf("Cloudflare account %s not found", accountID)
+			}
+		}
+		if cfg.APIToken == "" && (cfg.APIKey == "" || cfg.Email == "") {
+			return nil, fmt.Errorf("Cloudflare credentials not configured (api_token OR api_key+email required)")
+		}
+		return NewCloudflareProvider(cfg)
+	}
+
+	cfg, ok := store.GetDNSProvider(providerID)
+	if !ok {
+		return nil, fmt.Errorf("DNS provider %s not found", providerID)
+	}
+	return NewProvider(cfg)
+}
+
+// SwitchSubdomain points subdomain at ip during a failover or restore. A non-empty opts.Line restricts
+// the switch to that line's records, which requires a LineProvider.
+func SwitchSubdomain(ctx context.Context, p DNSProvider, zoneID, subdomain, ip string, opts UpdateOptions) ([]RecordResult, error) {
+	if opts.Line != "" {
+		if _, ok := p.(LineProvider); !ok {
+			return nil, fmt.Errorf("DNS provider does not support record lines")
+		}
+	}
+	return p.UpdateRecordBySubdomain(ctx, zoneID, subdomain, ip, opts)
+}
+
+// SwitchOptions returns the record selection configured on a monitor.
+func SwitchOptions(m config.MonitorConfig, proxied bool) UpdateOptions {
+	var expected []string
+	for _, ip := range []string{m.OriginalIP, m.BackupIP, m.ScheduleSwitchIP} {
+		if ip != "" {
+			expected = append(expected, ip)
+		}
+	}
+	return UpdateOptions{
+		Type:     m.RecordType,
+		RecordID: m.RecordID,
+		Line:     m.RecordLine,
+		Proxied:  proxied,
+		Create:   m.CreateIfMissing,
+		Expected: expected,
+	}
+}
+
+// ApplySwitch points a monitor at ip: it rewrites every subdomain's records, or with the lb_pool action
+// switches the origins of its Cloudflare load balancer pool. ctx is checked between subdomains so a
+// stopped monitor does not keep writing; errors for single subdomains are collected, not fatal.
+func ApplySwitch(ctx context.Context, store *config.Store, m config.MonitorConfig, ip string, proxied bool) ([]RecordResult, error) {
+	p, err := ProviderForMonitor(store, m)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Action == ActionLBPool {
+		cf, ok := p.(*CloudflareProvider)
+		if !ok {
+			return nil, fmt.Errorf("lb_pool action requires a Cloudflare provider")
+		}
+		return nil, cf.SwitchLBPool(ctx, m, ip)
+	}
+
+	var (
+		results []RecordResult
+		errs    []error
+	)
+	opts := SwitchOptions(m, proxied)
+	for _, sub := range m.Subdomains {
+		if err := ctx.Err(); err != nil {
+			return results, errors.Join(append(errs, err)...)
+		}
+		res, err := SwitchSubdomain(ctx, p, m.ZoneID, sub, ip, opts)
+		results = append(results, res...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sub, err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// ErrNoZone is returned by ResolveZone when no zone of the provider contains the name.
+var ErrNoZone = errors.New("no zone found")
+
+// ResolveZone returns the zone of p that fqdn belongs to, the most specific one when zones are nested.
+func ResolveZone(ctx context.Context, p DNSProvider, fqdn string) (Zone, error) {
+	zones, err := p.ListZones(ctx)
+	if err != nil {
+		return Zone{}, err
+	}
+	var (
+		best  Zone
+		found bool
+	)
+	for _, z := range zones {
+		if InZone(fqdn, z.Name) && (!found || len(strings.TrimSuffix(z.Name, ".")) > len(strings.TrimSuffix(best.Name, "."))) {
+			best, found = z, true
+		}
+	}
+	if !found {
+		return Zone{}, fmt.Errorf("%w for %s", ErrNoZone, fqdn)
+	}
+	return best, nil
+}
+
+// InZone reports whether fqdn is zone or one of its subdomains.
+func InZone(fqdn, zone string) bool {
+	name := strings.ToLower(strings.TrimSuffix(fqdn, "."))
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// NeedsZone reports whether switching m writes DNS records, and therefore needs a zone.
+func NeedsZone(m config.MonitorConfig) bool {
+	return m.Action != ActionLBPool
+}
+
+// switchRecords is the provider-neutral part of UpdateRecordBySubdomain. candidates are the records of
+// name as read from the provider; the ones with the wanted type (or just opts.RecordID) are planned by
+// PlanSwitch and updated in place, keeping their TTL, comment and tags. A new record is created only if
+// none matches and opts.Create is set.
+func switchRecords(ctx context.Context, p DNSProvider, zoneID, name, target string, opts UpdateOptions, candidates []Record) ([]RecordResult, error) {
+	typ := TargetType(target, opts.Type)
+	matched := MatchRecords(candidates, typ, opts.RecordID)
+
+	if len(matched) == 0 {
+		if opts.RecordID != "" {
+			return nil, fmt.Errorf("DNS record %s not found for %s", opts.RecordID, name)
+		}
+		if !opts.Create {
+			return nil, fmt.Errorf("no %s record found for %s", typ, name)
+		}
+		record := Record{Type: typ, Name: name, Content: target, TTL: 1, Line: opts.Line}
+		if Proxiable(typ) {
+			record.Proxied = &opts.Proxied
+		}
+		res := RecordResult{Name: name, Type: typ, Content: target, Status: RecordCreated}
+		created, err := p.CreateRecord(ctx, zoneID, record)
+		if err != nil {
+			res.Status, res.Error = RecordFailed, err.Error()
+			return []RecordResult{res}, err
+		}
+		res.ID = created.ID
+		return []RecordResult{res}, nil
+	}
+
+	results, err := PlanSwitch(matched, target, opts)
+	if err != nil {
+		return results, err
+	}
+	var errs []error
+	for i, r := range matched {
+		if results[i].Status != RecordUpdated {
+			continue
+		}
+		r.Content = target
+		if r.Proxied != nil {
+			r.Proxied = &opts.Proxied
+		}
+		if _, err := p.UpdateRecord(ctx, zoneID, r); err != nil {
+			results[i].Status, results[i].Error = RecordFailed, err.Error()
+			errs = append(errs, fmt.Errorf("%s %s: %w", r.Type, r.Name, err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// PlanSwitch decides what a switch does to each of matched, returning one result per record in the same
+// order. A record already holding target is unchanged (or updated when only its proxy flag differs). Of the
+// others, only records holding one of opts.Expected (any record when it is empty) are pointed at target,
+// and only as long as no record of the set holds target yet: a set cannot hold the same content twice.
+// Everything else is left in place and reported as skipped, so the other members of a round-robin set
+// survive a failover and a restore. It fails when no record would end up on target.
+func PlanSwitch(matched []Record, target string, opts UpdateOptions) ([]RecordResult, error) {
+	onTarget := slices.ContainsFunc(matched, func(r Record) bool { return SameContent(r.Content, target) })
+	results := make([]RecordResult, len(matched))
+	for i, r := range matched {
+		res := RecordResult{ID: r.ID, Name: r.Name, Type: r.Type, Content: target, Status: RecordUpdated}
+		switch {
+		case SameContent(r.Content, target):
+			if r.Proxied == nil || *r.Proxied == opts.Proxied {
+				res.Status = RecordUnchanged
+			}
+		case len(opts.Expected) > 0 && !slices.ContainsFunc(opts.Expected, func(ip string) bool { return SameContent(r.Content, ip) }):
+			res.Content, res.Status = r.Content, RecordSkipped
+			res.Error = "not one of the monitor's addresses"
+		case onTarget:
+			res.Content, res.Status = r.Content, RecordSkipped
+			res.Error = "target already in the record set"
+		default:
+			onTarget = true
+		}
+		results[i] = res
+	}
+	if onTarget {
+		return results, nil
+	}
+
+	// Every record holds an address the monitor does not know about; overwriting it could undo a manual change.
+	var errs []error
+	for i := range results {
+		results[i].Status = RecordFailed
+		results[i].Error = fmt.Sprintf("holds %s, not one of the monitor's addresses", results[i].Content)
+		errs = append(errs, fmt.Errorf("%s %s %s", results[i].Type, results[i].Name, results[i].Error))
+	}
+	return results, errors.Join(errs...)
+}
+
+// MatchRecords returns the records a switch applies to: those of type typ, or only recordID when set.
+func MatchRecords(records []Record, typ, recordID string) []Record {
+	var out []Record
+	for _, r := range records {
+		if strings.EqualFold(r.Type, typ) && (recordID == "" || r.ID == recordID) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// TargetType returns typ, or the record type implied by target when typ is empty.
+func TargetType(target, typ string) string {
+	if typ != "" {
+		return strings.ToUpper(typ)
+	}
+	addr := net.ParseIP(target)
+	switch {
+	case addr == nil:
+		return "CNAME"
+	case addr.To4() == nil:
+		return "AAAA"
+	default:
+		return "A"
+	}
+}
+
+// SameContent compares record contents, treating IP addresses by value and names case-insensitively.
+func SameContent(a, b string) bool {
+	if ipA, ipB := net.ParseIP(a), net.ParseIP(b); ipA != nil && ipB != nil {
+		return ipA.Equal(ipB)
+	}
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
+
+// Proxiable reports whether Cloudflare can proxy records of type typ.
+func Proxiable(typ string) bool {
+	return typ == "A" || typ == "AAAA" || typ == "CNAME"
+}
+
+// Seconds converts a configured number of seconds, returning def when it is not set.
+func Seconds(v int, def time.Duration) time.Duration {
+	if v <= 0 {
+		return def
+	}
+	return time.Duration(v) * time.Second
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// memProvider keeps the records of one zone in memory and, like Cloudflare, rejects a record whose
+// name, type and content duplicate an existing one.
+type memProvider struct {
+	records   []Record
+	nextID    int
+	failWrite bool
+	deleted   []string
+}
+
+func (p *memProvider) ListZones(context.Context) ([]Zone, error) {
+	return []Zone{{ID: "zone", Name: "example.test"}}, nil
+}
+
+func (p *memProvider) ListRecords(context.Context, string) ([]Record, error) {
+	return slices.Clone(p.records), nil
+}
+
+func (p *memProvider) duplicate(r Record) bool {
+	return slices.ContainsFunc(p.records, func(o Record) bool {
+		return o.ID != r.ID && o.Name == r.Name && o.Type == r.Type && o.Content == r.Content
+	})
+}
+
+func (p *memProvider) CreateRecord(_ context.Context, _ string, r Record) (Record, error) {
+	if p.duplicate(r) {
+		return Record{}, errors.New("an identical record already exists")
+	}
+	p.nextID++
+	r.ID = fmt.Sprintf("r%d", p.nextID)
+	p.records = append(p.records, r)
+	return r, nil
+}
+
+func (p *memProvider) UpdateRecord(_ context.Context, _ string, r Record) (Record, error) {
+	if p.failWrite {
+		return Record{}, errors.New("write failed")
+	}
+	if p.duplicate(r) {
+		return Record{}, errors.New("an identical record already exists")
+	}
+	for i := range p.records {
+		if p.records[i].ID == r.ID {
+			p.records[i] = r
+			return r, nil
+		}
+	}
+	return Record{}, fmt.Errorf("record %s not found", r.ID)
+}
+
+func (p *memProvider) DeleteRecord(_ context.Context, _ string, id string) error {
+	for i := range p.records {
+		if p.records[i].ID == id {
+			p.records = slices.Delete(p.records, i, i+1)
+			p.deleted = append(p.deleted, id)
+			return nil
+		}
+	}
+	return fmt.Errorf("record %s not found", id)
+}
+
+func (p *memProvider) UpdateRecordBySubdomain(ctx context.Context, zoneID, subdomain, target string, opts UpdateOptions) ([]RecordResult, error) {
+	return switchRecords(ctx, p, zoneID, subdomain, target, opts, p.records)
+}
+
+func (p *memProvider) LookupRecords(_ context.Context, _, subdomain, typ, _ string) ([]Record, error) {
+	var out []Record
+	for _, r := range p.records {
+		if r.Name == subdomain && strings.EqualFold(r.Type, typ) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func newMemProvider(contents ...string) *memProvider {
+	p := &memProvider{}
+	for _, c := range contents {
+		p.CreateRecord(context.Background(), "zone", Record{Type: "A", Name: "www.example.test", Content: c, TTL: 300})
+	}
+	p.CreateRecord(context.Background(), "zone", Record{Type: "TXT", Name: "www.example.test", Content: "keep me", TTL: 300})
+	return p
+}
+
+func contentsOf(p *memProvider, typ string) []string {
+	var out []string
+	for _, r := range p.records {
+		if r.Type == typ {
+			out = append(out, r.Content)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+func statuses(results []RecordResult) []string {
+	out := make([]string, 0, len(results))
+	for _, r := range results {
+		out = append(out, r.Status)
+	}
+	return out
+}
+
+var expected = UpdateOptions{Expected: []string{"192.0.2.1", "192.0.2.2"}}
+
+func TestSwitchMultiRecordSet(t *testing.T) {
+	p := newMemProvider("192.0.2.1", "198.51.100.7")
+
+	results, err := p.UpdateRecordBySubdomain(context.Background(), "zone", "www.example.test", "192.0.2.2", expected)
+	if err != nil {
+		t.Fatalf("switch: %v", err)
+	}
+	if got, want := statuses(results), []string{RecordUpdated, RecordSkipped}; !slices.Equal(got, want) {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+	if got, want := contentsOf(p, "A"), []string{"192.0.2.2", "198.51.100.7"}; !slices.Equal(got, want) {
+		t.Errorf("A records = %v, want %v", got, want)
+	}
+	if got := contentsOf(p, "TXT"); len(got) != 1 {
+		t.Errorf("TXT records = %v, other types must be untouched", got)
+	}
+
+	// Switching again is a no-op.
+	results, err = p.UpdateRecordBySubdomain(context.Background(), "zone", "www.example.test", "192.0.2.2", expected)
+	if err != nil || !slices.Equal(statuses(results), []string{RecordUnchanged, RecordSkipped}) {
+		t.Errorf("second switch = %v, %v", statuses(results), err)
+	}
+
+	// Restoring brings back the original set.
+	if _, err := p.UpdateRecordBySubdomain(context.Background(), "zone", "www.example.test", "192.0.2.1", expected); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if got, want := contentsOf(p, "A"), []string{"192.0.2.1", "198.51.100.7"}; !slices.Equal(got, want) {
+		t.Errorf("A records after restore = %v, want %v", got, want)
+	}
+	if len(p.deleted) != 0 {
+		t.Errorf("deleted %v", p.deleted)
+	}
+}
+
+func TestSwitchKeepsRecordAlreadyOnTarget(t *testing.T) {
+	p := newMemProvider("192.0.2.1", "192.0.2.2")
+
+	results, err := p.UpdateRecordBySubdomain(context.Background(), "zone", "www.example.test", "192.0.2.2", expected)
+	if err != nil {
+		t.Fatalf("switch: %v", err)
+	}
+	if got, want := statuses(results), []string{RecordSkipped, RecordUnchanged}; !slices.Equal(got, want) {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+	if got, want := contentsOf(p, "A"), []string{"192.0.2.1", "192.0.2.2"}; !slices.Equal(got, want) {
+		t.Errorf("A records = %v, want %v", got, want)
+	}
+	if len(p.deleted) != 0 {
+		t.Errorf("deleted %v", p.deleted)
+	}
+}
+
+func TestSwitchLeavesUnexpectedRecords(t *testing.T) {
+	p := newMemProvider("198.51.100.7")
+
+	results, err := p.UpdateRecordBySubdomain(context.Background(), "zone", "www.example.test", "192.0.2.2", expected)
+	if err == nil {
+		t.Fatal("switch of a record holding an unexpected value succeeded")
+	}
+	if got := statuses(results); !slices.Equal(got, []string{RecordFailed}) {
+		t.Errorf("statuses = %v", got)
+	}
+	if got := contentsOf(p, "A"); !slices.Equal(got, []string{"198.51.100.7"}) {
+		t.Errorf("A records = %v, want them untouched", got)
+	}
+}
+
+func TestSwitchFailedUpdate(t *testing.T) {
+	p := newMemProvider("192.0.2.1", "198.51.100.7")
+	p.failWrite = true
+
+	results, err := p.UpdateRecordBySubdomain(context.Background(), "zone", "www.example.test", "192.0.2.2", expected)
+	if err == nil {
+		t.Fatal("switch succeeded although the update failed")
+	}
+	if got, want := statuses(results), []string{RecordFailed, RecordSkipped}; !slices.Equal(got, want) {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+	if got, want := contentsOf(p, "A"), []string{"192.0.2.1", "198.51.100.7"}; !slices.Equal(got, want) {
+		t.Errorf("A records = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimitError reports that a provider throttled a request. RetryAfter is how long it asked the
+// client to wait, zero when it gave no hint.
+type RateLimitError struct {
+	Provider   string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *RateLimitError) Error() string {
+	msg := e.Provider + ": rate limited"
+	if e.Err != nil {
+		msg = e.Err.Error()
+	}
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %s)", e.RetryAfter)
+	}
+	return msg
+}
+
+func (e *RateLimitError) Unwrap() error { return e.Err }
+
+// RetryAfter reports whether err was caused by rate limiting, and how long the provider asked to wait.
+func RetryAfter(err error) (time.Duration, bool) {
+	var rl *RateLimitError
+	if errors.As(err, &rl) {
+		return rl.RetryAfter, true
+	}
+	return 0, false
+}
+
+// rateLimitTransport turns HTTP 429 responses into a RateLimitError carrying the response's
+// Retry-After, which clients such as cloudflare-go would otherwise discard.
+type rateLimitTransport struct {
+	provider string
+	base     http.RoundTripper
+}
+
+func (t rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+	resp.Body.Close()
+	return nil, &RateLimitError{Provider: t.provider, RetryAfter: retryAfterHeader(resp.Header)}
+}
+
+// retryAfterHeader reads Retry-After (seconds or an HTTP date), falling back to the RateLimit-Reset
+// seconds some APIs send instead.
+func retryAfterHeader(h http.Header) time.Duration {
+	if v := h.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+			return time.Duration(secs) * time.Second
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			if d := time.Until(at); d > 0 {
+				return d
+			}
+		}
+	}
+	if secs, err := strconv.Atoi(h.Get("Ratelimit-Reset")); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return 0
+}
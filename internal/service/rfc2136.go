@@ -0,0 +1,356 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"dns-failover/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+// RFC2136Provider updates records on any authoritative server (BIND, Knot, PowerDNS, ...) through
+// DNS UPDATE messages, optionally signed with TSIG.
+//
+// DNS has no record IDs, so a record's ID is its RR in presentation format, base64url encoded.
+type RFC2136Provider struct {
+	server  string
+	zones   []string
+	keyName string
+	secret  string
+	alg     string
+	client  *dns.Client
+}
+
+func NewRFC2136Provider(cfg config.DNSProviderConfig) (*RFC2136Provider, error) {
+	if cfg.Server == "" {
+		return nil, fmt.Errorf("rfc2136: server is required")
+	}
+	server := cfg.Server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	p := &RFC2136Provider{
+		server: server,
+		zones:  cfg.Zones,
+		client: &dns.Client{Net: "tcp", Timeout: 10 * time.Second},
+	}
+	if cfg.TSIGKeyName != "" {
+		if _, err := base64.StdEncoding.DecodeString(cfg.TSIGSecret); err != nil {
+			return nil, fmt.Errorf("rfc2136: tsig_secret must be base64: %w", err)
+		}
+		alg, err := tsigAlgorithm(cfg.TSIGAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		p.keyName = dns.Fqdn(cfg.TSIGKeyName)
+		p.secret = cfg.TSIGSecret
+		p.alg = alg
+		p.client.TsigSecret = map[string]string{p.keyName: p.secret}
+	}
+	return p, nil
+}
+
+func tsigAlgorithm(name string) (string, error) {
+	switch strings.TrimSuffix(strings.ToLower(name), ".") {
+	case "", "hmac-sha256":
+		return dns.HmacSHA256, nil
+	case "hmac-sha1":
+		return dns.HmacSHA1, nil
+	case "hmac-sha224":
+		return dns.HmacSHA224, nil
+	case "hmac-sha384":
+		return dns.HmacSHA384, nil
+	case "hmac-sha512":
+		return dns.HmacSHA512, nil
+	case "hmac-md5", "hmac-md5.sig-alg.reg.int":
+		return dns.HmacMD5, nil
+	default:
+		return "", fmt.Errorf("rfc2136: unsupported tsig_algorithm %q", name)
+	}
+}
+
+// ListZones returns the configured zones; DNS has no way to enumerate the zones a server is authoritative for.
+func (p *RFC2136Provider) ListZones(ctx context.Context) ([]Zone, error) {
+	out := make([]Zone, 0, len(p.zones))
+	for _, z := range p.zones {
+		name := strings.TrimSuffix(z, ".")
+		out = append(out, Zone{ID: name, Name: name, Status: "active"})
+	}
+	return out, nil
+}
+
+// ListRecords fetches the zone with AXFR, so the server must allow transfers for the TSIG key (or this host).
+func (p *RFC2136Provider) ListRecords(ctx context.Context, zoneID string) ([]Record, error) {
+	m := new(dns.Msg)
+	m.SetAxfr(dns.Fqdn(zoneID))
+	p.sign(m)
+
+	t := &dns.Transfer{TsigSecret: p.client.TsigSecret}
+	if deadline, ok := ctx.Deadline(); ok {
+		t.ReadTimeout = time.Until(deadline)
+	}
+	envelopes, err := t.In(m, p.server)
+	if err != nil {
+		return nil, fmt.Errorf("rfc2136: zone transfer of %s: %w", zoneID, err)
+	}
+
+	var out []Record
+	for env := range envelopes {
+		if env.Error != nil {
+			return nil, fmt.Errorf("rfc2136: zone transfer of %s: %w", zoneID, env.Error)
+		}
+		for _, rr := range env.RR {
+			switch rr.Header().Rrtype {
+			case dns.TypeSOA, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeDNSKEY:
+				continue
+			}
+			out = append(out, recordFromRR(rr))
+		}
+	}
+	return out, nil
+}
+
+func (p *RFC2136Provider) CreateRecord(ctx context.Context, zoneID string, record Record) (Record, error) {
+	rr, err := rrFromRecord(record)
+	if err != nil {
+		return Record{}, err
+	}
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zoneID))
+	m.Insert([]dns.RR{rr})
+	if err := p.exchange(ctx, m, rr.Header().Name); err != nil {
+		return Record{}, err
+	}
+	return recordFromRR(rr), nil
+}
+
+// UpdateRecord replaces the RR identified by record.ID. The UPDATE has the RRset as read just before as
+// prerequisite, so it is refused if that RR no longer exists or the set changed in the meantime.
+func (p *RFC2136Provider) UpdateRecord(ctx context.Context, zoneID string, record Record) (Record, error) {
+	old, err := rrFromID(record.ID)
+	if err != nil {
+		return Record{}, err
+	}
+	if record.Name == "" {
+		record.Name = old.Header().Name
+	}
+	if record.Type == "" {
+		record.Type = dns.TypeToString[old.Header().Rrtype]
+	}
+	if record.TTL == 0 {
+		record.TTL = int(old.Header().Ttl)
+	}
+	rr, err := rrFromRecord(record)
+	if err != nil {
+		return Record{}, err
+	}
+
+	current, err := p.query(ctx, old.Header().Name, old.Header().Rrtype)
+	if err != nil {
+		return Record{}, err
+	}
+	if !slices.ContainsFunc(current, func(c dns.RR) bool { return dns.IsDuplicate(c, old) }) {
+		return Record{}, fmt.Errorf("rfc2136: update %s refused: the record no longer exists", old.Header().Name)
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zoneID))
+	m.Used(current)
+	m.Remove([]dns.RR{old})
+	m.Insert([]dns.RR{rr})
+	if err := p.exchange(ctx, m, rr.Header().Name); err != nil {
+		return Record{}, err
+	}
+	return recordFromRR(rr), nil
+}
+
+func (p *RFC2136Provider) DeleteRecord(ctx context.Context, zoneID, recordID string) error {
+	old, err := rrFromID(recordID)
+	if err != nil {
+		return err
+	}
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zoneID))
+	m.Remove([]dns.RR{old})
+	return p.exchange(ctx, m, old.Header().Name)
+}
+
+// UpdateRecordBySubdomain reads the current RRset from the server and switches it in a single UPDATE.
+// The records are planned as for any other provider; the UPDATE removes and re-adds the records to
+// switch, with the whole RRset as read as prerequisite. A value-dependent prerequisite only holds when it
+// matches the complete RRset (RFC 2136 §3.2.5), and this way a concurrent change is never overwritten.
+func (p *RFC2136Provider) UpdateRecordBySubdomain(ctx context.Context, zoneID, subdomain, target string, opts UpdateOptions) ([]RecordResult, error) {
+	typ := TargetType(target, opts.Type)
+	switch typ {
+	case "CNAME", "NS", "MX":
+		target = dns.Fqdn(target)
+	}
+	qtype, ok := dns.StringToType[typ]
+	if !ok {
+		return nil, fmt.Errorf("rfc2136: unsupported record type %q", typ)
+	}
+	current, err := p.query(ctx, dns.Fqdn(subdomain), qtype)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]Record, 0, len(current))
+	for _, rr := range current {
+		candidates = append(candidates, recordFromRR(rr))
+	}
+	matched := MatchRecords(candidates, typ, opts.RecordID)
+	if len(matched) == 0 {
+		return switchRecords(ctx, p, zoneID, strings.TrimSuffix(subdomain, "."), target, opts, candidates)
+	}
+
+	results, err := PlanSwitch(matched, target, opts)
+	if err != nil {
+		return results, err
+	}
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zoneID))
+	var switched []int
+	for i, r := range matched {
+		if results[i].Status != RecordUpdated {
+			continue
+		}
+		old, err := rrFromID(r.ID)
+		if err != nil {
+			return nil, err
+		}
+		r.Content = target
+		rr, err := rrFromRecord(r)
+		if err != nil {
+			return nil, err
+		}
+		m.Remove([]dns.RR{old})
+		m.Insert([]dns.RR{rr})
+		results[i].ID = recordFromRR(rr).ID
+		switched = append(switched, i)
+	}
+	if len(switched) == 0 {
+		return results, nil
+	}
+	m.Used(current)
+	if err := p.exchange(ctx, m, dns.Fqdn(subdomain)); err != nil {
+		for _, i := range switched {
+			results[i].ID, results[i].Status, results[i].Error = matched[i].ID, RecordFailed, err.Error()
+		}
+		return results, err
+	}
+	return results, nil
+}
+
+// LookupRecords asks the server itself for the RRset.
+func (p *RFC2136Provider) LookupRecords(ctx context.Context, zoneID, subdomain, typ, line string) ([]Record, error) {
+	qtype, ok := dns.StringToType[strings.ToUpper(typ)]
+	if !ok {
+		return nil, fmt.Errorf("rfc2136: unsupported record type %q", typ)
+	}
+	current, err := p.query(ctx, dns.Fqdn(subdomain), qtype)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Record, 0, len(current))
+	for _, rr := range current {
+		out = append(out, recordFromRR(rr))
+	}
+	return out, nil
+}
+
+// query asks the server itself (not a recursive resolver) for name's RRset of type qtype.
+func (p *RFC2136Provider) query(ctx context.Context, name string, qtype uint16) ([]dns.RR, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.RecursionDesired = false
+	p.sign(m)
+
+	r, _, err := p.client.ExchangeContext(ctx, m, p.server)
+	if err != nil {
+		return nil, fmt.Errorf("rfc2136: query %s: %w", name, err)
+	}
+	if r.Rcode != dns.RcodeSuccess && r.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("rfc2136: query %s: %s", name, dns.RcodeToString[r.Rcode])
+	}
+
+	var out []dns.RR
+	for _, rr := range r.Answer {
+		if rr.Header().Rrtype == qtype && strings.EqualFold(rr.Header().Name, name) {
+			out = append(out, rr)
+		}
+	}
+	return out, nil
+}
+
+func (p *RFC2136Provider) exchange(ctx context.Context, m *dns.Msg, name string) error {
+	p.sign(m)
+	r, _, err := p.client.ExchangeContext(ctx, m, p.server)
+	if err != nil {
+		return fmt.Errorf("rfc2136: update %s: %w", name, err)
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		// NXRRSET / YXRRSET mean a prerequisite failed: the record changed since it was read.
+		return fmt.Errorf("rfc2136: update %s refused: %s", name, dns.RcodeToString[r.Rcode])
+	}
+	return nil
+}
+
+func (p *RFC2136Provider) sign(m *dns.Msg) {
+	if p.keyName != "" {
+		m.SetTsig(p.keyName, p.alg, 300, time.Now().Unix())
+	}
+}
+
+func rrFromRecord(record Record) (dns.RR, error) {
+	ttl := record.TTL
+	if ttl <= 1 {
+		ttl = 300 // Cloudflare's "auto" TTL is 1
+	}
+	content := record.Content
+	if record.Type == "MX" && record.Priority != nil {
+		content = fmt.Sprintf("%d %s", *record.Priority, content)
+	}
+	rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(record.Name), ttl, record.Type, content))
+	if err != nil {
+		return nil, fmt.Errorf("rfc2136: invalid record: %w", err)
+	}
+	if rr == nil {
+		return nil, fmt.Errorf("rfc2136: empty record")
+	}
+	return rr, nil
+}
+
+func rrFromID(id string) (dns.RR, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return nil, fmt.Errorf("rfc2136: invalid record id")
+	}
+	rr, err := dns.NewRR(string(raw))
+	if err != nil || rr == nil {
+		return nil, fmt.Errorf("rfc2136: invalid record id")
+	}
+	return rr, nil
+}
+
+func recordFromRR(rr dns.RR) Record {
+	h := rr.Header()
+	content := strings.TrimPrefix(rr.String(), h.String())
+	record := Record{
+		ID:      base64.RawURLEncoding.EncodeToString([]byte(rr.String())),
+		Type:    dns.TypeToString[h.Rrtype],
+		Name:    strings.TrimSuffix(h.Name, "."),
+		Content: content,
+		TTL:     int(h.Ttl),
+	}
+	if mx, ok := rr.(*dns.MX); ok {
+		record.Content = mx.Mx
+		record.Priority = &mx.Preference
+	}
+	return record
+}
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"dns-failover/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	testZone    = "example.test."
+	testKeyName = "failover."
+	testSecret  = "c2VjcmV0LWtleS1mb3ItdGVzdHM=" // base64("secret-key-for-tests")
+)
+
+// stubServer is a minimal authoritative server for one zone that answers queries and applies RFC 2136
+// updates, requiring TSIG on updates.
+type stubServer struct {
+	mu      sync.Mutex
+	rrs     []dns.RR
+	updates []*dns.Msg
+}
+
+func (s *stubServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	defer func() {
+		if t := req.IsTsig(); t != nil {
+			resp.SetTsig(t.Hdr.Name, t.Algorithm, 300, int64(t.TimeSigned))
+		}
+		w.WriteMsg(resp)
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if req.Opcode != dns.OpcodeUpdate {
+		q := req.Question[0]
+		resp.Authoritative = true
+		for _, rr := range s.rrs {
+			if strings.EqualFold(rr.Header().Name, q.Name) && rr.Header().Rrtype == q.Qtype {
+				resp.Answer = append(resp.Answer, dns.Copy(rr))
+			}
+		}
+		return
+	}
+
+	if req.IsTsig() == nil || w.TsigStatus() != nil {
+		resp.Rcode = dns.RcodeNotAuth
+		return
+	}
+	s.updates = append(s.updates, req.Copy())
+	if rcode := s.checkPrereqLocked(req.Answer); rcode != dns.RcodeSuccess {
+		resp.Rcode = rcode
+		return
+	}
+	for _, rr := range req.Ns {
+		switch rr.Header().Class {
+		case dns.ClassNONE:
+			s.rrs = removeRR(s.rrs, rr)
+		case dns.ClassANY:
+			s.rrs = slices.DeleteFunc(s.rrs, func(o dns.RR) bool { return sameRRset(o, rr) })
+		default:
+			if !slices.ContainsFunc(s.rrs, func(o dns.RR) bool { return sameRdata(o, rr) }) {
+				s.rrs = append(s.rrs, rr)
+			}
+		}
+	}
+}
+
+// checkPrereqLocked evaluates the prerequisite section as RFC 2136 §3.2.5 does: value-dependent
+// prerequisites are collected per RRset, and each collected set must equal the zone's RRset exactly.
+func (s *stubServer) checkPrereqLocked(prereqs []dns.RR) int {
+	var temp []dns.RR
+	for _, pre := range prereqs {
+		h := pre.Header()
+		switch {
+		case h.Class == dns.ClassANY && !slices.ContainsFunc(s.rrs, func(o dns.RR) bool { return sameRRset(o, pre) }):
+			return dns.RcodeNXRrset
+		case h.Class == dns.ClassNONE && slices.ContainsFunc(s.rrs, func(o dns.RR) bool { return sameRRset(o, pre) }):
+			return dns.RcodeYXRrset
+		case h.Class == dns.ClassINET:
+			temp = append(temp, pre)
+		}
+	}
+	for _, pre := range temp {
+		var want, have []dns.RR
+		for _, rr := range temp {
+			if sameRRset(rr, pre) {
+				want = append(want, rr)
+			}
+		}
+		for _, rr := range s.rrs {
+			if sameRRset(rr, pre) {
+				have = append(have, rr)
+			}
+		}
+		for _, rr := range want {
+			if !slices.ContainsFunc(have, func(o dns.RR) bool { return sameRdata(o, rr) }) {
+				return dns.RcodeNXRrset
+			}
+		}
+		for _, rr := range have {
+			if !slices.ContainsFunc(want, func(o dns.RR) bool { return sameRdata(o, rr) }) {
+				return dns.RcodeNXRrset
+			}
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+func (s *stubServer) contents(name string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for _, rr := range s.rrs {
+		if strings.EqualFold(rr.Header().Name, name) {
+			out = append(out, strings.TrimPrefix(rr.String(), rr.Header().String()))
+		}
+	}
+	return out
+}
+
+func removeRR(rrs []dns.RR, del dns.RR) []dns.RR {
+	out := rrs[:0]
+	for _, rr := range rrs {
+		if !sameRdata(rr, del) {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+func sameRRset(a, b dns.RR) bool {
+	return strings.EqualFold(a.Header().Name, b.Header().Name) && a.Header().Rrtype == b.Header().Rrtype
+}
+
+// sameRdata compares name, type and rdata, ignoring TTL and class as prerequisites and deletes do.
+func sameRdata(a, b dns.RR) bool {
+	ha, hb := a.Header(), b.Header()
+	return strings.EqualFold(ha.Name, hb.Name) && ha.Rrtype == hb.Rrtype &&
+		strings.TrimPrefix(a.String(), ha.String()) == strings.TrimPrefix(b.String(), hb.String())
+}
+
+func startStub(t *testing.T, records ...string) (*stubServer, *RFC2136Provider) {
+	t.Helper()
+	stub := &stubServer{}
+	for _, s := range records {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stub.rrs = append(stub.rrs, rr)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	srv := &dns.Server{
+		Listener:          ln,
+		Handler:           stub,
+		TsigSecret:        map[string]string{testKeyName: testSecret},
+		NotifyStartedFunc: func() { close(started) },
+		// The default accept func answers UPDATE with NOTIMP.
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+
+	p, err := NewRFC2136Provider(config.DNSProviderConfig{
+		Type:        ProviderRFC2136,
+		Server:      ln.Addr().String(),
+		Zones:       []string{testZone},
+		TSIGKeyName: testKeyName,
+		TSIGSecret:  testSecret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stub, p
+}
+
+func TestRFC2136SwitchUsesExpectedValueAsPrerequisite(t *testing.T) {
+	stub, p := startStub(t, "www.example.test. 300 IN A 192.0.2.1")
+
+	opts := UpdateOptions{Expected: []string{"192.0.2.1", "192.0.2.2"}}
+	results, err := p.UpdateRecordBySubdomain(context.Background(), "example.test", "www.example.test", "192.0.2.2", opts)
+	if err != nil {
+		t.Fatalf("switch: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != RecordUpdated {
+		t.Fatalf("results = %+v", results)
+	}
+	if got := stub.contents("www.example.test."); len(got) != 1 || got[0] != "192.0.2.2" {
+		t.Fatalf("records after switch = %v", got)
+	}
+
+	if len(stub.updates) != 1 || len(stub.updates[0].Answer) != 1 {
+		t.Fatalf("expected one update with one prerequisite, got %v", stub.updates)
+	}
+	pre, ok := stub.updates[0].Answer[0].(*dns.A)
+	if !ok || !pre.A.Equal(net.ParseIP("192.0.2.1")) {
+		t.Fatalf("prerequisite = %v, want the expected old value 192.0.2.1", stub.updates[0].Answer[0])
+	}
+}
+
+func TestRFC2136SwitchLeavesUnexpectedValues(t *testing.T) {
+	stub, p := startStub(t, "www.example.test. 300 IN A 198.51.100.7")
+
+	opts := UpdateOptions{Expected: []string{"192.0.2.1", "192.0.2.2"}}
+	results, err := p.UpdateRecordBySubdomain(context.Background(), "example.test", "www.example.test", "192.0.2.2", opts)
+	if err == nil {
+		t.Fatal("switch of a record holding an unexpected value succeeded")
+	}
+	if len(results) != 1 || results[0].Status != RecordFailed {
+		t.Fatalf("results = %+v", results)
+	}
+	if len(stub.updates) != 0 {
+		t.Fatalf("sent %d updates, want none", len(stub.updates))
+	}
+	if got := stub.contents("www.example.test."); len(got) != 1 || got[0] != "198.51.100.7" {
+		t.Fatalf("records after refused switch = %v", got)
+	}
+}
+
+func TestRFC2136UpdateRefusedWhenRecordChanged(t *testing.T) {
+	stub, p := startStub(t, "www.example.test. 300 IN A 192.0.2.1")
+
+	records, err := p.LookupRecords(context.Background(), "example.test", "www.example.test", "A", "")
+	if err != nil || len(records) != 1 {
+		t.Fatalf("lookup: %v %v", records, err)
+	}
+	// Someone else changes the record between the read and the update.
+	stub.mu.Lock()
+	stub.rrs[0].(*dns.A).A = net.ParseIP("192.0.2.9")
+	stub.mu.Unlock()
+
+	r := records[0]
+	r.Content = "192.0.2.2"
+	if _, err := p.UpdateRecord(context.Background(), "example.test", r); err == nil {
+		t.Fatal("update succeeded although its prerequisite no longer holds")
+	}
+	if got := stub.contents("www.example.test."); len(got) != 1 || got[0] != "192.0.2.9" {
+		t.Fatalf("records after refused update = %v", got)
+	}
+}
+
+func TestRFC2136SwitchMultiRecordSet(t *testing.T) {
+	stub, p := startStub(t,
+		"www.example.test. 300 IN A 192.0.2.1",
+		"www.example.test. 300 IN A 198.51.100.7",
+	)
+
+	opts := UpdateOptions{Expected: []string{"192.0.2.1", "192.0.2.2"}}
+	results, err := p.UpdateRecordBySubdomain(context.Background(), "example.test", "www.example.test", "192.0.2.2", opts)
+	if err != nil {
+		t.Fatalf("switch: %v", err)
+	}
+	if len(results) != 2 || results[0].Status != RecordUpdated || results[1].Status != RecordSkipped {
+		t.Fatalf("results = %+v", results)
+	}
+	got := stub.contents("www.example.test.")
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"192.0.2.2", "198.51.100.7"}) {
+		t.Fatalf("records after switch = %v", got)
+	}
+	if len(stub.updates) != 1 || len(stub.updates[0].Answer) != 2 {
+		t.Fatalf("expected one update with the whole RRset as prerequisite, got %v", stub.updates)
+	}
+
+	// UpdateRecord reads the RRset again, so a member added since the listing is part of its prerequisite.
+	rr, _ := dns.NewRR("www.example.test. 300 IN A 203.0.113.5")
+	records, err := p.LookupRecords(context.Background(), "example.test", "www.example.test", "A", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.mu.Lock()
+	stub.rrs = append(stub.rrs, rr)
+	stub.mu.Unlock()
+	for _, r := range records {
+		if r.Content == "192.0.2.2" {
+			r.Content = "192.0.2.1"
+			if _, err := p.UpdateRecord(context.Background(), "example.test", r); err != nil {
+				t.Fatalf("update of a record still in the set: %v", err)
+			}
+		}
+	}
+	got = stub.contents("www.example.test.")
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"192.0.2.1", "198.51.100.7", "203.0.113.5"}) {
+		t.Fatalf("records after update = %v", got)
+	}
+}
@@ -2,7 +2,6 @@ package service
 
 import (
 	"bytes"
-	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"crypto/tls"
@@ -17,194 +16,8 @@ import (
 	"time"
 
 	"dns-failover/internal/config"
-
-	"github.com/cloudflare/cloudflare-go"
 )
 
-type DNSService struct {
-	api *cloudflare.API
-}
-
-func NewDNSService(cfg config.CloudflareConfig) (*DNSService, error) {
-	var (
-		api *cloudflare.API
-		err error
-	)
-
-	if cfg.APIToken != "" {
-		api, err = cloudflare.NewWithAPIToken(cfg.APIToken)
-	} else {
-		api, err = cloudflare.New(cfg.APIKey, cfg.Email)
-	}
-	if err != nil {
-		return nil, err
-	}
-	return &DNSService{api: api}, nil
-}
-
-// ListZones 获取所有域名列表
-func (s *DNSService) ListZones(ctx context.Context) ([]cloudflare.Zone, error) {
-	zones, err := s.api.ListZones(ctx)
-	if err != nil {
-		return nil, err
-	}
-	return zones, nil
-}
-
-// ListRecords 获取特定 Zone 的所有解析记录
-func (s *DNSService) ListRecords(ctx context.Context, zoneID string) ([]cloudflare.DNSRecord, error) {
-	records, _, err := s.api.ListDNSRecords(ctx, cloudflare.ZoneIdentifier(zoneID), cloudflare.ListDNSRecordsParams{})
-	if err != nil {
-		return nil, err
-	}
-	return records, nil
-}
-
-// GetRecord 获取特定解析记录详情
-func (s *DNSService) GetRecord(ctx context.Context, zoneID, recordID string) (cloudflare.DNSRecord, error) {
-	return s.api.GetDNSRecord(ctx, cloudflare.ZoneIdentifier(zoneID), recordID)
-}
-
-// CreateRecord 创建解析记录
-func (s *DNSService) CreateRecord(ctx context.Context, zoneID string, params cloudflare.CreateDNSRecordParams) (cloudflare.DNSRecord, error) {
-	return s.api.CreateDNSRecord(ctx, cloudflare.ZoneIdentifier(zoneID), params)
-}
-
-// UpdateRecord 更新解析记录
-func (s *DNSService) UpdateRecord(ctx context.Context, zoneID string, params cloudflare.UpdateDNSRecordParams) (cloudflare.DNSRecord, error) {
-	return s.api.UpdateDNSRecord(ctx, cloudflare.ZoneIdentifier(zoneID), params)
-}
-
-// DeleteRecord 删除解析记录
-func (s *DNSService) DeleteRecord(ctx context.Context, zoneID, recordID string) error {
-	return s.api.DeleteDNSRecord(ctx, cloudflare.ZoneIdentifier(zoneID), recordID)
-}
-
-// UpdateRecordBySubdomain 根据子域名更新 IP (用于 Failover)
-func (s *DNSService) UpdateRecordBySubdomain(ctx context.Context, zoneID, subdomain, ip string, proxied bool) error {
-	records, _, err := s.api.ListDNSRecords(ctx, cloudflare.ZoneIdentifier(zoneID), cloudflare.ListDNSRecordsParams{
-		Name: subdomain,
-	})
-	if err != nil {
-		return err
-	}
-
-	if len(records) == 0 {
-		return fmt.Errorf("no DNS record found for %s", subdomain)
-	}
-
-	recordID := records[0].ID
-	_, err = s.api.UpdateDNSRecord(ctx, cloudflare.ZoneIdentifier(zoneID), cloudflare.UpdateDNSRecordParams{
-		ID:      recordID,
-		Type:    "A",
-		Name:    subdomain,
-		Content: ip,
-		Proxied: &proxied,
-	})
-
-	return err
-}
-
-// SearchRecords 搜索解析记录
-func (s *DNSService) SearchRecords(ctx context.Context, zoneID, query string) ([]cloudflare.DNSRecord, error) {
-	records, _, err := s.api.ListDNSRecords(ctx, cloudflare.ZoneIdentifier(zoneID), cloudflare.ListDNSRecordsParams{})
-	if err != nil {
-		return nil, err
-	}
-
-	var results []cloudflare.DNSRecord
-	query = strings.ToLower(query)
-	for _, record := range records {
-		if strings.Contains(strings.ToLower(record.Name), query) ||
-			strings.Contains(strings.ToLower(record.Content), query) ||
-			strings.Contains(strings.ToLower(record.Type), query) {
-			results = append(results, record)
-		}
-	}
-	return results, nil
-}
-
-// BulkUpdateRecords 批量更新解析记录
-func (s *DNSService) BulkUpdateRecords(ctx context.Context, zoneID string, updates []BulkUpdateRequest) ([]BulkUpdateResult, error) {
-	var results []BulkUpdateResult
-
-	for _, update := range updates {
-		result := BulkUpdateResult{
-			RecordID: update.RecordID,
-			Success:  false,
-		}
-
-		record, err := s.GetRecord(ctx, zoneID, update.RecordID)
-		if err != nil {
-			result.Error = err.Error()
-			results = append(results, result)
-			continue
-		}
-
-		params := cloudflare.UpdateDNSRecordParams{
-			ID:      update.RecordID,
-			Type:    record.Type,
-			Name:    record.Name,
-			Content: update.Content,
-			TTL:     update.TTL,
-			Proxied: update.Proxied,
-		}
-
-		if update.Content != "" {
-			params.Content = update.Content
-		}
-		if update.TTL > 0 {
-			params.TTL = update.TTL
-		}
-		if update.Proxied != nil {
-			params.Proxied = update.Proxied
-		}
-
-		_, err = s.UpdateRecord(ctx, zoneID, params)
-		if err != nil {
-			result.Error = err.Error()
-		} else {
-			result.Success = true
-		}
-		results = append(results, result)
-	}
-
-	return results, nil
-}
-
-// GetZoneAnalytics 获取域名分析数据
-func (s *DNSService) GetZoneAnalytics(ctx context.Context, zoneID string) (cloudflare.ZoneAnalyticsData, error) {
-	return s.api.ZoneAnalyticsDashboard(ctx, zoneID, cloudflare.ZoneAnalyticsOptions{})
-}
-
-// GetZoneSettings 获取域名设置
-func (s *DNSService) GetZoneSettings(ctx context.Context, zoneID string) (*cloudflare.ZoneSettingResponse, error) {
-	return s.api.ZoneSettings(ctx, zoneID)
-}
-
-// UpdateZoneSetting 更新域名设置
-func (s *DNSService) UpdateZoneSetting(ctx context.Context, zoneID string, setting cloudflare.ZoneSetting) (cloudflare.ZoneSetting, error) {
-	return s.api.UpdateZoneSetting(ctx, &cloudflare.ResourceContainer{Identifier: zoneID}, cloudflare.UpdateZoneSettingParams{
-		Name:  setting.ID,
-		Value: setting.Value,
-	})
-}
-
-// BulkUpdateRequest 批量更新请求
-type BulkUpdateRequest struct {
-	RecordID string `json:"record_id"`
-	Content  string `json:"content,omitempty"`
-	TTL      int    `json:"ttl,omitempty"`
-	Proxied  *bool  `json:"proxied,omitempty"`
-}
-
-// BulkUpdateResult 批量更新结果
-type BulkUpdateResult struct {
-	RecordID string `json:"record_id"`
-	Success  bool   `json:"success"`
-	Error    string `json:"error,omitempty"`
-}
-
 type NotificationService struct {
 	ding     config.DingTalkConfig
 	email    config.EmailConfig
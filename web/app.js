@@ -5,6 +5,7 @@ class DNSManager {
         this.baseURL = origin && origin !== 'null' ? origin : 'http://localhost:8081';
         this.currentZoneId = null;
         this.currentZoneName = null;
+        this.zonesAccountId = '';
         this.monitorInterval = null;
         this.startTime = Date.now();
         this.monitorsCache = [];
@@ -180,7 +181,8 @@ class DNSManager {
 
             let zones = [];
             try {
-                zones = await this.apiRequest('/api/zones');
+                await this.loadZonesAccount();
+                zones = await this.apiRequest(this.zonesPath('/api/zones'));
             } catch {
                 zones = [];
             }
@@ -240,9 +242,10 @@ class DNSManager {
         
         container.innerHTML = monitors.slice(0, 5).map(monitor => {
             const runtime = runtimeById.get(monitor.id);
-            const isDown = runtime?.status === 'Down';
+            const isHeld = runtime?.status === 'Held';
+            const isDown = runtime?.status === 'Down' || isHeld;
             const statusClass = isDown ? 'status-error' : 'status-normal';
-            const statusText = isDown ? '故障' : '正常';
+            const statusText = isHeld ? '待确认切换' : (isDown ? '故障' : '正常');
             const target = monitor.check_target || monitor.original_ip || '';
             
             return `
@@ -311,7 +314,8 @@ class DNSManager {
 
     async fetchZones() {
         try {
-            const zones = await this.apiRequest('/api/zones');
+            await this.loadZonesAccount();
+            const zones = await this.apiRequest(this.zonesPath('/api/zones'));
             this.renderZones(zones);
         } catch (error) {
             console.error('获取域名列表失败:', error);
@@ -319,6 +323,22 @@ class DNSManager {
         }
     }
 
+    // 域名浏览固定使用获取域名列表时激活的 Cloudflare 账户，解析记录操作与从此处新建的监控都使用该账户
+    async loadZonesAccount() {
+        try {
+            const data = await this.apiRequest('/api/cloudflare-accounts');
+            const accounts = data.accounts || [];
+            this.zonesAccountId = accounts[data.active_index || 0]?.id || '';
+        } catch {
+            this.zonesAccountId = '';
+        }
+    }
+
+    zonesPath(path) {
+        if (!this.zonesAccountId) return path;
+        return `${path}${path.includes('?') ? '&' : '?'}account_id=${encodeURIComponent(this.zonesAccountId)}`;
+    }
+
     renderZones(zones) {
         const container = document.getElementById('zone-list');
         if (!container) return;
@@ -417,7 +437,7 @@ class DNSManager {
 
     async fetchRecords(zoneId) {
         try {
-            const records = await this.apiRequest(`/api/zones/${zoneId}/records`);
+            const records = await this.apiRequest(this.zonesPath(`/api/zones/${zoneId}/records`));
             this.recordsCache = Array.isArray(records) ? records : [];
             this.renderRecords(records);
         } catch (error) {
@@ -599,9 +619,10 @@ class DNSManager {
         }
         
         container.innerHTML = monitors.map(monitor => {
-            const isDown = monitor.runtime?.status === 'Down';
+            const isHeld = monitor.runtime?.status === 'Held';
+            const isDown = monitor.runtime?.status === 'Down' || isHeld;
             const statusClass = isDown ? 'status-error' : 'status-normal';
-            const statusText = isDown ? '故障' : '正常';
+            const statusText = isHeld ? '待确认切换' : (isDown ? '故障' : '正常');
             const statusIcon = isDown 
                 ? '<svg class="w-4 h-4" fill="none" stroke="currentColor" viewBox="0 0 24 24"><path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M6 18L18 6M6 6l12 12"></path></svg>'
                 : '<svg class="w-4 h-4" fill="none" stroke="currentColor" viewBox="0 0 24 24"><path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M5 13l4 4L19 7"></path></svg>';
@@ -1021,7 +1042,7 @@ class DNSManager {
         }
         if (!confirm('确定要删除这条DNS记录吗？')) return;
         try {
-            await this.apiRequest(`/api/zones/${this.currentZoneId}/records/${recordId}`, { method: 'DELETE' });
+            await this.apiRequest(this.zonesPath(`/api/zones/${this.currentZoneId}/records/${recordId}`), { method: 'DELETE' });
             this.showNotification('删除成功', 'success');
             await this.fetchRecords(this.currentZoneId);
         } catch (error) {
@@ -1070,13 +1091,13 @@ class DNSManager {
         if (!payload.content) throw new Error('请填写记录内容');
 
         if (this.editingRecordId) {
-            await this.apiRequest(`/api/zones/${this.currentZoneId}/records/${this.editingRecordId}`, {
+            await this.apiRequest(this.zonesPath(`/api/zones/${this.currentZoneId}/records/${this.editingRecordId}`), {
                 method: 'PUT',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify(payload)
             });
         } else {
-            await this.apiRequest(`/api/zones/${this.currentZoneId}/records`, {
+            await this.apiRequest(this.zonesPath(`/api/zones/${this.currentZoneId}/records`), {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify(payload)
@@ -1231,10 +1252,32 @@ class DNSManager {
         document.getElementById('monitor-timeout-seconds').value = monitor.timeout_seconds ?? 2;
         document.getElementById('monitor-original-cdn').checked = !!monitor.original_ip_cdn_enabled;
         document.getElementById('monitor-backup-cdn').checked = !!monitor.backup_ip_cdn_enabled;
+        // 从域名浏览新建时绑定正在浏览的账户，否则绑定当前激活的账户
+        const account = this.editingMonitorId ? (monitor.account_id || null) : (this.currentZoneId ? this.zonesAccountId : null);
+        this.loadMonitorAccounts(account);
 
         modal.classList.remove('hidden');
     }
 
+    // 填充监控绑定的 Cloudflare 账户；未指定时默认绑定当前激活的账户，之后切换激活账户不影响该监控
+    async loadMonitorAccounts(selected) {
+        const select = document.getElementById('monitor-account-id');
+        if (!select) return;
+        try {
+            const data = await this.apiRequest('/api/cloudflare-accounts');
+            const accounts = data.accounts || [];
+            if (!selected) {
+                selected = accounts[data.active_index || 0]?.id || '';
+            }
+            select.innerHTML = accounts.length
+                ? accounts.map(acc => `<option value="${acc.id}">${acc.name || acc.id}</option>`).join('')
+                : '<option value="">默认凭证</option>';
+            select.value = selected;
+        } catch (error) {
+            console.error('Failed to load accounts:', error);
+        }
+    }
+
     hideMonitorModal() {
         const modal = document.getElementById('monitor-modal');
         if (modal) modal.classList.add('hidden');
@@ -1257,6 +1300,7 @@ class DNSManager {
         const payload = {
             name: document.getElementById('monitor-name').value.trim(),
             zone_id: document.getElementById('monitor-zone-id').value.trim(),
+            account_id: document.getElementById('monitor-account-id').value,
             subdomains: this.normalizeSubdomains(document.getElementById('monitor-subdomains').value),
             check_type: checkType,
             check_target: checkTarget,
@@ -1272,7 +1316,6 @@ class DNSManager {
         };
 
         if (!payload.name) throw new Error('请填写策略名称');
-        if (!payload.zone_id) throw new Error('请填写 Zone ID');
         if (!payload.original_ip) throw new Error('请填写主IP');
         if (!payload.backup_ip) throw new Error('请填写备IP');
         if (!payload.subdomains.length) throw new Error('请至少填写一个子域名');
@@ -1280,14 +1323,15 @@ class DNSManager {
             throw new Error('HTTP/HTTPS 检测需要填写检测目标(URL)');
         }
 
+        let result;
         if (this.editingMonitorId) {
-            await this.apiRequest(`/api/monitors/${this.editingMonitorId}`, {
+            result = await this.apiRequest(`/api/monitors/${this.editingMonitorId}`, {
                 method: 'PUT',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify(payload)
             });
         } else {
-            await this.apiRequest('/api/monitors', {
+            result = await this.apiRequest('/api/monitors', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify(payload)
@@ -1295,7 +1339,11 @@ class DNSManager {
         }
 
         this.hideMonitorModal();
-        this.showNotification('保存成功', 'success');
+        if (result?.warnings?.length) {
+            this.showNotification(`已保存，但：${result.warnings.join('；')}`, 'warning');
+        } else {
+            this.showNotification('保存成功', 'success');
+        }
         await this.fetchMonitors();
         await this.loadDashboardData();
     }